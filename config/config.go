@@ -5,14 +5,13 @@ import (
 	"os"
 )
 
-var BeforePath string = "./toolchain/before.gsm"
-var AfterPath string = "./toolchain/after.gsm"
+var ToolchainDir string = "" // --toolchain, empty for GISMO_TOOLCHAIN or ./toolchain
 var OutputPath string = "out.a"
 var OutputFile *os.File = nil
 var OutputEnabled bool = true
-
-// For inbuilt function $IOTA start value
-var IotaValue int = 0
+var TraceExpansion bool = false
+var DiagnosticsFormat string = "text"
+var WarningFlags []string = nil // -W<code>, -Wno-<code> and -Werror in command line order
 
 func Init() {
 
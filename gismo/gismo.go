@@ -0,0 +1,206 @@
+// Package gismo is the embedding API of the Gismo interpiler.
+//
+// Every call to Compile runs on its own interpreter, so several compilations
+// can run concurrently in one process without sharing definitions, caches or output.
+package gismo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"gismolang.org/compiler/interpreter"
+	"gismolang.org/compiler/parser"
+	"gismolang.org/compiler/toolchain"
+)
+
+// Severity classifies a diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem reported by the parser or the interpreter.
+type Diagnostic struct {
+	Severity Severity
+	Code     string // Kind of the problem, e.g. "syntax" or "no-match"
+	Source   string
+	Line     int // 1-based, 0 if unknown
+	Column   int // 1-based, 0 if unknown
+	Message  string
+}
+
+// Error returns the diagnostic in the form "source:line:column: message".
+func (diagnostic Diagnostic) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", diagnostic.Source, diagnostic.Line, diagnostic.Column, diagnostic.Message)
+}
+
+// Source is a named piece of Gismo code.
+type Source struct {
+	Name string
+	Code string
+}
+
+// Options configure a compilation.
+type Options struct {
+	// Sources are interpreted in order, after the toolchain prelude and before its postlude.
+	Sources []Source
+	// Toolchain is a toolchain directory with its preludes and postludes
+	// (see package toolchain). Empty for none.
+	Toolchain string
+	// Output receives everything written with $WRITE and $WRITEB. Nil discards it.
+	Output io.Writer
+	// Stdout receives everything printed with $PRINT and $PRINTLN. Nil discards it.
+	Stdout io.Writer
+	// Trace receives a log of every macro dispatch. Nil disables the trace.
+	Trace io.Writer
+	// TraceOutput receives the trace switched on with $TRACE(on) when Trace is nil. Nil discards it.
+	TraceOutput io.Writer
+	// LibraryPath lists the roots searched by $LOAD after the directory of the loading file.
+	// Nil uses GISMO_PATH.
+	LibraryPath []string
+	// DisabledWarnings lists warning codes that are not reported (like -Wno-<code>).
+	DisabledWarnings []string
+	// WarningsAsErrors makes the compilation fail if any warning is reported (like -Werror).
+	WarningsAsErrors bool
+}
+
+// Compile runs the toolchain and the sources on a fresh interpreter.
+// It returns all diagnostics of the run, warnings first. The error is nil if the compilation succeeded;
+// otherwise it is the first error diagnostic or a problem reading the toolchain.
+// A panic inside the interpreter, such as a division by zero in $DIV, is returned as an error diagnostic.
+func Compile(ctx context.Context, options Options) (diagnostics []Diagnostic, err error) {
+	sources, err := toolchainSources(options)
+	if err != nil {
+		return nil, err
+	}
+
+	interp := interpreter.NewInterpreter(ctx, options.Output, options.Stdout)
+	current := ""
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			diagnostic := Diagnostic{
+				Severity: SeverityError,
+				Code:     interpreter.CodeRuntime,
+				Source:   current,
+				Message:  fmt.Sprintf("internal error: %v", recovered),
+			}
+			diagnostics, err = append(fromWarnings(interp), diagnostic), diagnostic
+		}
+	}()
+	interp.SetTraceOutput(options.TraceOutput)
+	interp.SetTrace(options.Trace)
+	if options.LibraryPath != nil {
+		interp.SetLibraryPath(options.LibraryPath)
+	}
+	interp.SetWarningsAsErrors(options.WarningsAsErrors)
+	for _, code := range options.DisabledWarnings {
+		interp.SetWarningEnabled(code, false)
+	}
+	for _, source := range sources {
+		current = source.Name
+		ast, syntaxErrors := interp.Parse(source.Code, source.Name)
+		if len(syntaxErrors) > 0 {
+			diagnostics := fromWarnings(interp)
+			for _, syntaxError := range syntaxErrors {
+				diagnostics = append(diagnostics, fromSyntaxError(syntaxError))
+			}
+			return diagnostics, diagnostics[len(diagnostics)-len(syntaxErrors)]
+		}
+		if err := interp.RunSource(ast, source.Name); err != nil {
+			diagnostic := fromRuntimeError(err, source.Name)
+			return append(fromWarnings(interp), diagnostic), diagnostic
+		}
+	}
+
+	diagnostics = fromWarnings(interp)
+	if options.WarningsAsErrors && len(diagnostics) > 0 {
+		return diagnostics, diagnostics[0]
+	}
+	return diagnostics, nil
+}
+
+// toolchainSources returns the sources surrounded by the preludes and postludes of the toolchain.
+func toolchainSources(options Options) ([]Source, error) {
+	if options.Toolchain == "" {
+		return options.Sources, nil
+	}
+	tc, err := toolchain.Load(options.Toolchain)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := readSources(tc.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := readSources(tc.After)
+	if err != nil {
+		return nil, err
+	}
+	sources := append(before, options.Sources...)
+	return append(sources, after...), nil
+}
+
+func readSources(paths []string) ([]Source, error) {
+	var sources []Source
+	for _, path := range paths {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("toolchain: %w", err)
+		}
+		sources = append(sources, Source{Name: path, Code: string(code)})
+	}
+	return sources, nil
+}
+
+// fromWarnings converts the warnings reported so far. With WarningsAsErrors they are errors.
+func fromWarnings(interp *interpreter.Interpreter) []Diagnostic {
+	severity := SeverityWarning
+	if interp.WarningsAsErrors() {
+		severity = SeverityError
+	}
+	var diagnostics []Diagnostic
+	for _, warning := range interp.Warnings() {
+		diagnostic := Diagnostic{Severity: severity, Code: warning.Code, Message: warning.Message}
+		if warning.Token != nil {
+			diagnostic.Source = warning.Token.Source
+			diagnostic.Line = warning.Token.Line
+			diagnostic.Column = warning.Token.Column
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+func fromSyntaxError(syntaxError parser.Diagnostic) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityError,
+		Code:     interpreter.CodeSyntax,
+		Source:   syntaxError.Source,
+		Line:     syntaxError.Line,
+		Column:   syntaxError.Column,
+		Message:  syntaxError.Message(),
+	}
+}
+
+func fromRuntimeError(err error, source string) Diagnostic {
+	diagnostic := Diagnostic{
+		Severity: SeverityError,
+		Code:     interpreter.CodeRuntime,
+		Source:   source,
+		Message:  err.Error(),
+	}
+	if raised, ok := err.(*interpreter.Error); ok && raised.Code != "" {
+		diagnostic.Code = raised.Code
+	}
+	if raised, ok := err.(*interpreter.Error); ok && raised.Token != nil {
+		diagnostic.Source = raised.Token.Source
+		diagnostic.Line = raised.Token.Line
+		diagnostic.Column = raised.Token.Column
+	}
+	return diagnostic
+}
@@ -0,0 +1,39 @@
+package gismo
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompileRecoversRuntimePanics(t *testing.T) {
+	diagnostics, err := Compile(context.Background(), Options{
+		Sources: []Source{{Name: "div.gsm", Code: "$DIV(1, 0)\n"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a division by zero")
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Severity != SeverityError || diagnostics[0].Source != "div.gsm" {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	if !strings.Contains(err.Error(), "internal error") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// The QBE toolchain rejects nested ifs with an if(*) defined inside the body of an if,
+// which must shadow the more specific if(VALUE_BOOL) defined outside of it.
+func TestInnerDefinitionShadowsOuterOne(t *testing.T) {
+	_, err := Compile(context.Background(), Options{
+		Toolchain: "../examples/qbe/toolchain",
+		Sources: []Source{{Name: "nested.gsm", Code: `
+f(n: i32): i32 {
+    if (n == 0) return if (n == 1) return n
+    n
+}
+`}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "Nested ifs are not allowed") {
+		t.Errorf("expected the nested if error, got %v", err)
+	}
+}
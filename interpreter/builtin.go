@@ -2,17 +2,13 @@ package interpreter
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strings"
 
-	"gismolang.org/compiler/config"
 	"gismolang.org/compiler/parser"
-	"gismolang.org/compiler/tokenizer"
 )
 
-var fileLoadCache = make(map[string]Value)
-
 func Builtins() []BuiltinFunction {
     return []BuiltinFunction{
         // Arithmetic
@@ -47,15 +43,30 @@ func Builtins() []BuiltinFunction {
         {callback: vectorLen, identifier: "$VECTOR_LEN"},
         {callback: vectorResize, identifier: "$VECTOR_RESIZE"},
 
+        // Map
+        {callback: mapCreate, identifier: "$MAP"},
+        {callback: mapGet, identifier: "$MAP_GET"},
+        {callback: mapSet, identifier: "$MAP_SET"},
+        {callback: mapHas, identifier: "$MAP_HAS"},
+        {callback: mapDel, identifier: "$MAP_DEL"},
+        {callback: mapKeys, identifier: "$MAP_KEYS"},
+
+        // Record
+        {callback: recorder, identifier: "$RECORD"},
+        {callback: fieldGet, identifier: "$FIELD"},
+        {callback: wither, identifier: "$WITH"},
+
         // Comparison
         {callback: equals, identifier: "$EQUALS"},
         {callback: greater, identifier: "$GREATER"},
+        {callback: notter, identifier: "$NOT"},
 
         // Type
         {callback: typedef, identifier: "$TYPEDEF"},
         {callback: typeof, identifier: "$TYPEOF"},
         {callback: untype, identifier: "$UNTYPE"},
         {callback: unionizer, identifier: "$UNION"},
+        {callback: subtyper, identifier: "$SUBTYPE"},
 
         // Control Flow
         {callback: ifFunc, identifier: "$IF"},
@@ -82,13 +93,20 @@ func Builtins() []BuiltinFunction {
         // Misc
         {callback: flatter, identifier: "$FLATTEN"},
         {callback: raiser, identifier: "$RAISE"},
+        {callback: warner, identifier: "$WARN"},
+        {callback: tryer, identifier: "$TRY"},
         {callback: niler, identifier: "$NIL"},
         {callback: iotainator, identifier: "$IOTA"},
         {callback: exporter, identifier: "$EXPORT"},
         {callback: loadFile, identifier: "$LOAD"},
+        {callback: loadFileOnce, identifier: "$LOAD_ONCE"},
         {callback: printScope, identifier: "$SCOPE"},
         {callback: catSym, identifier: "$SYMCAT"},
         {callback: suggester, identifier: "$SUGGEST"},
+        {callback: precedencer, identifier: "$PRECEDENCE"},
+        {callback: tracer, identifier: "$TRACE"},
+        {callback: hygiener, identifier: "$HYGIENE"},
+        {callback: gensymer, identifier: "$GENSYM"},
     }
 }
 
@@ -254,23 +272,23 @@ func printValue(args Value, scope *Scope) Value {
         return &Nil{}
     }
     value := interpretExpression(argsList[0], scope)
-    fmt.Print(value)
+    fmt.Fprint(scope.interpreter.stdout, value)
     return &Nil{}
 }
 
 func printlnValue(args Value, scope *Scope) Value {
     argsList := getArgsList(args)
     if len(argsList) < 1 {
-        fmt.Println()
+        fmt.Fprintln(scope.interpreter.stdout)
         return &Nil{}
     }
     value := interpretExpression(argsList[0], scope)
-    fmt.Println(value)
+    fmt.Fprintln(scope.interpreter.stdout, value)
     return &Nil{}
 }
 
 func printScope(args Value, scope *Scope) Value {
-    fmt.Println(scope)
+    fmt.Fprintln(scope.interpreter.stdout, scope)
     return &Nil{}
 }
 
@@ -301,9 +319,10 @@ func typeof(args Value, scope *Scope) Value {
         }
     }
 
-    if typedValue, ok := left.(*TypedValue); ok {
-        for _, t := range typedValue.TypeFallbacks {
-            if t.String() == right.String() {
+    // Fallback types and supertypes
+    if _, ok := left.(*TypedValue); ok || scope.interpreter.subtyping {
+        for _, t := range scope.gatherTypeStrings(left) {
+            if t == right.String() {
                 return &Integer{
                     Value: 1,
                 }
@@ -314,6 +333,17 @@ func typeof(args Value, scope *Scope) Value {
     return &Nil{}
 }
 
+// $SUBTYPE(sub, super)
+// Declares that values of type sub also match patterns for super, see subtype.go.
+func subtyper(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+    scope.declareSubtype(argsList[0].String(), argsList[1].String(), args)
+    return &Nil{}
+}
+
 func untype(args Value, scope *Scope) Value {
     argsList := getArgsList(args)
     if len(argsList) < 1 {
@@ -327,7 +357,7 @@ func untype(args Value, scope *Scope) Value {
 }
 
 func quote(args Value, scope *Scope) Value {
-    return args
+    return unwrapAll(args)
 }
 
 func replace(args Value, scope *Scope) Value {
@@ -367,7 +397,7 @@ func lambda(args Value, scope *Scope) Value {
                 value = interpretExpression(value, callerScope)
                 arg := &ConsCell{
                     Car: &Symbol{
-                        Value: "@call",
+                        Value: parser.CallOperator,
                     },
                     Cdr: &ConsCell{
                         Car: &Symbol{
@@ -460,6 +490,19 @@ func equals(args Value, scope *Scope) Value {
     return &Nil{}
 }
 
+// $NOT(x)
+// Returns 1 if x is Nil, else Nil.
+func notter(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 1 {
+        return &Nil{}
+    }
+    if interpretExpression(argsList[0], scope).GetTypeString() == "Nil" {
+        return &Integer{Value: 1}
+    }
+    return &Nil{}
+}
+
 func greater(args Value, scope *Scope) Value {
     argsList := getArgsList(args)
     if len(argsList) < 2 {
@@ -530,9 +573,7 @@ func write2Output(args Value, scope *Scope) Value {
         return &Nil{}
     }
     message := interpretExpression(argsList[0], scope).String()
-    if config.OutputEnabled && config.OutputFile != nil {
-        config.OutputFile.WriteString(message)
-    }
+    io.WriteString(scope.interpreter.output, message)
     return &Nil{}
 }
 
@@ -542,8 +583,8 @@ func writeByte2Output(args Value, scope *Scope) Value {
         return &Nil{}
     }
     result := interpretExpression(argsList[0], scope)
-    if number, ok := result.(*Integer); ok && config.OutputEnabled && config.OutputFile != nil {
-        config.OutputFile.Write([]byte{byte(number.Value)})
+    if number, ok := result.(*Integer); ok {
+        scope.interpreter.output.Write([]byte{byte(number.Value)})
     }
     return &Nil{}
 }
@@ -551,39 +592,57 @@ func writeByte2Output(args Value, scope *Scope) Value {
 func niler(args Value, scope *Scope) Value {
     return &Nil{}
 }
+// $LOAD(path)
+// Runs a file in the current scope. A relative path is resolved against the directory of the
+// file containing the call first, then against every library root in GISMO_PATH.
 func loadFile(args Value, scope *Scope) Value {
+    return loadFileWith(args, scope, false)
+}
+
+// $LOAD_ONCE(path)
+// Like $LOAD, but does nothing if the file has already been loaded in this scope or an enclosing one.
+func loadFileOnce(args Value, scope *Scope) Value {
+    return loadFileWith(args, scope, true)
+}
+
+func loadFileWith(args Value, scope *Scope, once bool) Value {
     argsList := getArgsList(args)
     if len(argsList) < 1 {
         return &Nil{}
     }
 
-    rawPath := interpretExpression(argsList[0], scope).String()
-
-    absPath, err := filepath.Abs(rawPath)
-    if err != nil {
-        return &Nil{}
+    if _, empty := argsList[0].(*Nil); empty {
+        raiseAt(CodeLoad, argsList[0], "Expected the path of the file to load")
     }
-
-    canonicalPath, err := filepath.EvalSymlinks(absPath)
-    if err != nil {
+    rawPath := interpretExpression(argsList[0], scope).String()
+    canonicalPath := scope.interpreter.resolveLoadPath(rawPath, argsList[0])
+    if once && scope.hasLoaded(canonicalPath) {
         return &Nil{}
     }
+    defer scope.enterLoad(canonicalPath, argsList[0])()
 
     var programValue Value
 
-    if cached, found := fileLoadCache[canonicalPath]; found {
+    cacheKey := loadCacheKey{path: canonicalPath, precedences: scope.interpreter.precedences.Version()}
+    if cached, found := scope.interpreter.fileLoadCache[cacheKey]; found {
         programValue = cached
     } else {
         bytes, err := os.ReadFile(canonicalPath)
         if err != nil {
-            return &Nil{}
+            raiseAt(CodeLoad, argsList[0], "cannot load %s: %v", rawPath, err)
         }
 
-        tokens := tokenizer.Tokenize(string(bytes), canonicalPath)
-        ast := parser.Parse(tokens, canonicalPath)
+        ast, diagnostics := scope.interpreter.Parse(string(bytes), canonicalPath)
+        if len(diagnostics) > 0 {
+            messages := make([]string, len(diagnostics))
+            for i, diagnostic := range diagnostics {
+                messages[i] = diagnostic.String()
+            }
+            RuntimeError(argsList[0].GetToken(), "Syntax errors in '%s':\n  %s", rawPath, strings.Join(messages, "\n  "))
+        }
         programValue = syntaxNode2Value(ast)
 
-        fileLoadCache[canonicalPath] = programValue
+        scope.interpreter.fileLoadCache[cacheKey] = programValue
     }
 
     if consCell, ok := programValue.(*ConsCell); ok {
@@ -617,6 +676,7 @@ func whiler(args Value, scope *Scope) Value {
     cond := argsList[0]
     body := argsList[1]
     for interpretExpression(cond, scope).GetTypeString() != "Nil" {
+        scope.interpreter.checkCancelled(cond.GetToken())
         interpretExpression(body, scope)
     }
     return &Nil{}
@@ -735,8 +795,133 @@ func vectorResize(args Value, scope *Scope) Value {
     return &Nil{}
 }
 
+// $MAP(key, value, ...)
+// Creates a map with the given entries, see map.go.
+func mapCreate(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    m := NewMap()
+    for i := 0; i+1 < len(argsList); i += 2 {
+        keyVal := interpretExpression(argsList[i], scope)
+        key, ok := newMapKey(keyVal)
+        if !ok {
+            raiseAt(CodeRuntime, argsList[i], "Map keys must be strings, symbols or ints, got %s", keyVal.GetTypeString())
+        }
+        m.Set(key, keyVal, interpretExpression(argsList[i+1], scope))
+    }
+    return m
+}
+
+func mapGet(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+    if m, key, _ := mapArguments(argsList, scope); m != nil {
+        if value, found := m.Get(key); found {
+            return value
+        }
+    }
+    return &Nil{}
+}
+
+func mapSet(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 3 {
+        return &Nil{}
+    }
+    m, key, keyVal := mapArguments(argsList, scope)
+    valueVal := interpretExpression(argsList[2], scope)
+    if m != nil {
+        m.Set(key, keyVal, valueVal)
+        return valueVal
+    }
+    return &Nil{}
+}
+
+func mapHas(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+    if m, key, _ := mapArguments(argsList, scope); m != nil {
+        if _, found := m.Get(key); found {
+            return &Integer{Value: 1}
+        }
+    }
+    return &Nil{}
+}
+
+// $MAP_DEL(map, key)
+// Removes the key and returns its value, Nil if it was not present.
+func mapDel(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+    if m, key, _ := mapArguments(argsList, scope); m != nil {
+        if removed := m.Delete(key); removed != nil {
+            return removed
+        }
+    }
+    return &Nil{}
+}
+
+// $MAP_KEYS(map)
+// Returns a Vector of the keys in insertion order.
+func mapKeys(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 1 {
+        return &Nil{}
+    }
+    if m, ok := interpretExpression(argsList[0], scope).(*Map); ok {
+        return &Vector{Elements: m.Keys()}
+    }
+    return &Nil{}
+}
+
+// $RECORD(name, field, ...)
+// Declares a record type with a constructor and .field access, see record.go.
+func recorder(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 1 {
+        return &Nil{}
+    }
+    scope.declareRecord(argsList[0], argsList[1:])
+    return &Nil{}
+}
+
+// $FIELD(record, field)
+// Returns the value of the field. The field name is not evaluated.
+func fieldGet(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+    record, field := recordArguments(argsList, scope)
+    value, found := record.Field(field)
+    if !found {
+        raiseNoField(record, field, argsList[1])
+    }
+    return value
+}
+
+// $WITH(record, field, value)
+// Returns a copy of the record with the field replaced. The field name is not evaluated.
+func wither(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 3 {
+        return &Nil{}
+    }
+    record, field := recordArguments(argsList, scope)
+    updated, found := record.With(field, interpretExpression(argsList[2], scope))
+    if !found {
+        raiseNoField(record, field, argsList[1])
+    }
+    return updated
+}
+
 func isolator(value Value, scope *Scope) Value {
-    isolatedScope := NewEmptyScope()
+    isolatedScope := scope.interpreter.newRootScope()
     return interpretExpression(value, isolatedScope)
 }
 
@@ -749,17 +934,73 @@ func raiser(args Value, scope *Scope) Value {
     // 1. The marked value
     targetValue := argsList[0]
 
+    // Re-raise a caught error unchanged
+    if raised, ok := targetValue.(*Error); ok && len(argsList) == 1 {
+        panic(raised)
+    }
+
     // 2. The Error Message
     message := "An error occurred"
     if len(argsList) > 1 {
         message = interpretExpression(argsList[1], scope).String()
     }
 
-    RuntimeError(targetValue.GetToken(), message)
+    raiseAt(CodeRaised, targetValue, "%s", message)
+
+    return &Nil{}
+}
+
+// $WARN(node, [code], message)
+// Reports a warning at the node without stopping the compilation.
+// The code is used to enable or disable the warning with -W<code> and -Wno-<code>.
+func warner(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+
+    code := CodeWarning
+    messageArg := argsList[1]
+    if len(argsList) > 2 {
+        code = interpretExpression(argsList[1], scope).String()
+        messageArg = argsList[2]
+    }
+    message := interpretExpression(messageArg, scope).String()
 
+    scope.interpreter.warn(code, argsList[0], "%s", message)
     return &Nil{}
 }
 
+// $TRY(expr, errVar, handler)
+// Evaluates expr. If it raises an error, handler is evaluated instead with errVar bound to the Error value.
+// Without a handler the Error value itself is returned. Output written before the error is not undone.
+func tryer(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 1 {
+        return &Nil{}
+    }
+
+    var result Value = &Nil{}
+    raised := catchError(func() {
+        result = interpretExpression(argsList[0], scope)
+    })
+    if raised == nil {
+        return result
+    }
+    if raised.Code == CodeCancelled {
+        panic(raised) // Cancellation stops the whole compilation
+    }
+    if len(argsList) < 3 {
+        return raised
+    }
+
+    variableName := interpretExpression(argsList[1], scope)
+    if varSym, ok := variableName.(*Symbol); ok {
+        return interpretExpression(subSymbol(argsList[2], varSym, raised, true), scope)
+    }
+    return interpretExpression(argsList[2], scope)
+}
+
 func unionizer(args Value, scope *Scope) Value {
     argsList := getArgsList(args)
     values := make([]Value, len(argsList))
@@ -795,6 +1036,12 @@ func foreacher(args Value, scope *Scope) Value {
                 newBody := subSymbol(body, varSym, element, true)
                 interpretExpression(newBody, scope)
             }
+        case *Map:
+            // The keys are taken before the loop, so the body can modify the map
+            for _, key := range collection.Keys() {
+                newBody := subSymbol(body, varSym, key, true)
+                interpretExpression(newBody, scope)
+            }
         case *String:
             for _, b := range []byte(collection.Value) {
                 element := &Integer{Value: int64(b), BaseValue: BaseValue{Token: collection.GetToken()}}
@@ -807,8 +1054,8 @@ func foreacher(args Value, scope *Scope) Value {
 }
 
 func iotainator(args Value, scope *Scope) Value {
-    currentValue := config.IotaValue
-    config.IotaValue++
+    currentValue := scope.interpreter.iotaValue
+    scope.interpreter.iotaValue++
     return &Integer{
         Value: int64(currentValue),
     }
@@ -869,9 +1116,9 @@ func suggester(args Value, scope *Scope) Value {
     value := interpretExpression(argsList[0], scope)
     
     // Using the helper from scope.go (same package)
-    types := gatherTypeStrings(value)
+    types := scope.gatherTypeStrings(value)
 
-    fmt.Printf("Possible macros:\n")
+    fmt.Fprintf(scope.interpreter.stdout, "Possible macros:\n")
 
     seen := make(map[string]bool)
     current := scope
@@ -899,15 +1146,13 @@ func suggester(args Value, scope *Scope) Value {
                 
                 if match && !seen[key] {
                     // Format: * a
-                    fmt.Printf(" - %s %s\n", opName, opType)
+                    fmt.Fprintf(scope.interpreter.stdout, " - %s %s\n", opName, opType)
                     seen[key] = true
                 }
 
             } else if len(parts) == 3 {
                 // Binary: Check if parts[1] (Left Type) or parts[2] (Right Type) matches
-                opName := parts[0]
                 leftType := parts[1]
-                rightType := parts[2]
                 
                 match := false
                 for _, t := range types {
@@ -919,13 +1164,7 @@ func suggester(args Value, scope *Scope) Value {
 
                 if match && !seen[key] {
                     // Format: a * b
-                    if opName == "@call" {
-                        fmt.Printf(" - %s(%s)\n", leftType, rightType)
-                    } else if opName == "@curlyCall" {
-                        fmt.Printf(" - %s { %s }\n", leftType, rightType)
-                    } else {
-                        fmt.Printf(" - %s %s %s\n", leftType, opName, rightType)
-                    }
+                    fmt.Fprintf(scope.interpreter.stdout, " - %s\n", formatSignature(parts))
                     seen[key] = true
                 }
             }
@@ -934,4 +1173,86 @@ func suggester(args Value, scope *Scope) Value {
     }
 
     return &Nil{}
-}
\ No newline at end of file
+}
+// $PRECEDENCE(operator, precedence, [left|right])
+// Sets the binding power of a binary operator for all code parsed afterwards.
+func precedencer(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 2 {
+        return &Nil{}
+    }
+    operator := interpretExpression(argsList[0], scope).String()
+    precedenceVal := interpretExpression(argsList[1], scope)
+    precedence, ok := precedenceVal.(*Integer)
+    if !ok || precedence.Value <= 0 {
+        RuntimeError(argsList[1].GetToken(), "Precedence of '%s' must be a positive integer, got %s", operator, precedenceVal.String())
+        return &Nil{}
+    }
+
+    rightAssoc := false
+    if len(argsList) > 2 {
+        switch associativity := argsList[2].String(); associativity {
+        case "left":
+        case "right":
+            rightAssoc = true
+        default:
+            RuntimeError(argsList[2].GetToken(), "Unknown associativity '%s' (expected left or right)", associativity)
+            return &Nil{}
+        }
+    }
+
+    scope.interpreter.precedences.Set(operator, int(precedence.Value), rightAssoc)
+    return &Nil{}
+}
+
+// $TRACE(on|off)
+// Starts or stops logging every macro dispatch as an indented tree.
+func tracer(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 1 {
+        return &Nil{}
+    }
+    switch mode := argsList[0].String(); mode {
+    case "on":
+        scope.interpreter.tracing = true
+    case "off":
+        scope.interpreter.tracing = false
+    default:
+        raiseAt(CodeRuntime, argsList[0], "Unknown trace mode '%s' (expected on or off)", mode)
+    }
+    return &Nil{}
+}
+
+// $HYGIENE(on|off)
+// Macros defined while hygiene is on rename the symbols they bind with ::= on every expansion,
+// so that symbols in their arguments cannot be captured.
+func hygiener(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    if len(argsList) < 1 {
+        return &Nil{}
+    }
+    switch mode := argsList[0].String(); mode {
+    case "on":
+        scope.interpreter.hygiene = true
+    case "off":
+        scope.interpreter.hygiene = false
+    default:
+        raiseAt(CodeRuntime, argsList[0], "Unknown hygiene mode '%s' (expected on or off)", mode)
+    }
+    return &Nil{}
+}
+
+// $GENSYM([prefix])
+// Returns a fresh symbol such as prefix.1 that cannot clash with any symbol written in code.
+func gensymer(args Value, scope *Scope) Value {
+    argsList := getArgsList(args)
+    prefix := "g"
+    if len(argsList) > 0 {
+        if prefixVal := interpretExpression(argsList[0], scope); prefixVal.GetTypeString() != "Nil" {
+            prefix = prefixVal.String()
+        }
+    }
+    symbol := scope.interpreter.gensym(prefix)
+    symbol.Token = args.GetToken()
+    return symbol
+}
@@ -0,0 +1,339 @@
+package interpreter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+// A macro call is dispatched to the most specific definition that matches it. Every argument is
+// ranked by how its pattern matched:
+//
+//	exact type  <  generic type  <  fallback type (in the order of gatherTypeStrings)  <  *  <  ...
+//
+// A generic pattern such as Pointer<T> (see typeterm.go) ranks right after the exact type it matched.
+// A definition is more specific than another if it matches every argument at least as well and one
+// argument better. Specificity only decides within one scope: the matching definitions of the
+// innermost scope that has any shadow those of outer scopes, however specific those are, so a block
+// can override a macro for everything nested in it. If no single definition of that scope is better
+// than all other matching ones, e.g. `small + int` and `int + small` for a call small + small, the
+// call is ambiguous and an error lists the tied candidates.
+//
+// Definitions whose where guard evaluates to Nil do not take part, see guard.go.
+
+// macroCall holds the arguments of a macro call. They are evaluated on demand and at most once.
+type macroCall struct {
+	scope     *Scope
+	raw       []Value
+	values    []Value           // nil until evaluated
+	outputs   []*deferredOutput // Output written by evaluating the arguments, if recorded
+	recording bool              // Record the output, as a wildcard may get the argument (see wildcard.go)
+}
+
+func newMacroCall(scope *Scope, raw []Value) *macroCall {
+	return &macroCall{scope: scope, raw: raw, values: make([]Value, len(raw)), outputs: make([]*deferredOutput, len(raw))}
+}
+
+func (call *macroCall) value(i int) Value {
+	if call.values[i] == nil {
+		if _, isCode := call.raw[i].(*ConsCell); isCode && call.recording {
+			call.values[i], call.outputs[i] = call.scope.interpreter.recordOutput(call.raw[i], call.scope)
+		} else {
+			call.values[i] = interpretExpression(call.raw[i], call.scope)
+		}
+	}
+	return call.values[i]
+}
+
+// writeOutput writes the recorded output of the arguments that was not written yet.
+func (call *macroCall) writeOutput() {
+	for _, output := range call.outputs {
+		output.replay(call.scope.interpreter)
+	}
+}
+
+// typeStrings evaluates all arguments and returns their type strings.
+func (call *macroCall) typeStrings() []string {
+	types := make([]string, len(call.raw))
+	for i := range call.raw {
+		types[i] = call.value(i).GetTypeString()
+	}
+	return types
+}
+
+// evaluatedTypeStrings returns the type strings of the arguments, with * for those not evaluated.
+func (call *macroCall) evaluatedTypeStrings() []string {
+	types := make([]string, len(call.raw))
+	for i, value := range call.values {
+		types[i] = "*"
+		if value != nil {
+			types[i] = value.GetTypeString()
+		}
+	}
+	return types
+}
+
+// macroBinding holds the arguments of a call bound to the patterns of a definition.
+type macroBinding struct {
+	arguments     []Value           // $1..$n, raw code at wildcard positions
+	rest          Value             // $..., nil without a rest pattern
+	whole         Value             // $$
+	typeVariables map[string]Value  // Type variables of generic patterns, see typeterm.go
+	actualTypes   []string          // Type strings of the arguments, for the trace
+	output        []*deferredOutput // Recorded output of the arguments bound as values
+}
+
+// bind binds the arguments of the call to the patterns of a definition that matches it.
+// Generic patterns must have been replaced by the type strings they matched.
+func (call *macroCall) bind(macroName string, patterns []string, typeVariables map[string]Value, operatorToken *tokenizer.Token) *macroBinding {
+	fixed := patterns
+	rest := len(patterns) > 0 && patterns[len(patterns)-1] == restPattern
+	if rest {
+		fixed = patterns[:len(patterns)-1]
+	}
+
+	binding := &macroBinding{typeVariables: typeVariables}
+	for i, pattern := range fixed {
+		if pattern == "*" {
+			binding.arguments = append(binding.arguments, call.wildcardArgument(i)) // Raw code for wildcards
+			binding.actualTypes = append(binding.actualTypes, "*")
+			continue
+		}
+		argumentVal := call.value(i)
+		binding.output = append(binding.output, call.outputs[i])
+		binding.arguments = append(binding.arguments, call.scope.resolveValueForType(argumentVal, pattern))
+		binding.actualTypes = append(binding.actualTypes, argumentVal.GetTypeString())
+	}
+
+	wholeArguments := binding.arguments
+	if rest {
+		elements := []Value{}
+		for i := len(fixed); i < len(call.raw); i++ {
+			elements = append(elements, call.value(i))
+			binding.output = append(binding.output, call.outputs[i])
+			binding.actualTypes = append(binding.actualTypes, call.value(i).GetTypeString())
+		}
+		binding.rest = &Vector{Elements: elements, BaseValue: BaseValue{Token: operatorToken}}
+		wholeArguments = append(append([]Value{}, binding.arguments...), elements...)
+	}
+	binding.whole = wholeExpression(macroName, operatorToken, wholeArguments...)
+	if len(call.raw) == 1 {
+		binding.arguments = append(binding.arguments, &Nil{}) // Unary macros see Nil as $2
+	}
+	return binding
+}
+
+// typePattern is a pattern an argument can be matched with, and how well it matches.
+type typePattern struct {
+	name  string
+	score int
+}
+
+// typeRankStep separates the scores of consecutive type strings of gatherTypeStrings, leaving room
+// for generic patterns in between.
+const typeRankStep = 64
+
+// exactScore ranks matching the i-th type string of gatherTypeStrings exactly.
+func exactScore(i int) int { return i * typeRankStep }
+
+// genericScore ranks matching the i-th type string with a generic pattern; more specific ones first.
+func genericScore(i int, pattern string) int {
+	specificity := typeSpecificity(parseTypeTerm(pattern, nil), make(map[string]bool))
+	if specificity >= typeRankStep {
+		specificity = typeRankStep - 1
+	}
+	return i*typeRankStep + typeRankStep - specificity
+}
+
+// typePatterns returns the type strings of the value as patterns, the exact type first.
+func (currentScope *Scope) typePatterns(value Value) []typePattern {
+	var patterns []typePattern
+	for i, typeString := range currentScope.gatherTypeStrings(value) {
+		patterns = append(patterns, typePattern{name: typeString, score: exactScore(i)})
+	}
+	return patterns
+}
+
+// matchPattern matches the argument at the position against one pattern of a definition key,
+// extending the bindings of type variables. It returns the score and the pattern to bind the
+// argument with: the matched type string for a generic pattern, else the pattern itself.
+func (call *macroCall) matchPattern(position int, pattern string, typeVariables map[string]Value) (int, string, bool) {
+	if pattern == "*" {
+		return wildcardRank, pattern, true
+	}
+	typeStrings := call.scope.gatherTypeStrings(call.value(position))
+	for i, typeString := range typeStrings {
+		if typeString == pattern {
+			return exactScore(i), pattern, true
+		}
+	}
+	if isGenericPattern(pattern) {
+		for i, typeString := range typeStrings {
+			if unifyType(pattern, typeString, typeVariables) {
+				return genericScore(i, pattern), typeString, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// appendGenericCandidates adds the definitions with a generic pattern that match the call with
+// exactly its number of arguments. Other definitions are found by their key in applyUnaryMacro
+// and applyBinaryMacro.
+func (currentScope *Scope) appendGenericCandidates(candidates []*candidate, macroName string, call *macroCall) []*candidate {
+	if !currentScope.interpreter.genericNames[macroName] {
+		return candidates
+	}
+	searchPrefix := macroName + " "
+	depth := 0
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		for key, chain := range searchScope.definitionsMap {
+			if !strings.HasPrefix(key, searchPrefix) {
+				continue
+			}
+			parts := strings.Split(key, " ")
+			if isNaryKey(parts) || len(parts)-1 != len(call.raw) || !containsGenericPattern(parts[1:]) {
+				continue
+			}
+			if found := call.matchCandidate(parts[1:], depth, chain); found != nil {
+				candidates = append(candidates, found)
+			}
+		}
+		depth++
+	}
+	return candidates
+}
+
+func containsGenericPattern(patterns []string) bool {
+	for _, pattern := range patterns {
+		if isGenericPattern(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidate is a definition key, as defined in one scope, that matches a call.
+type candidate struct {
+	patterns      []string         // Patterns to bind the arguments with
+	scores        []int            // How well each argument matched, lower is better
+	rest          bool             // Has a rest pattern, which ranks below every fixed-arity definition
+	depth         int              // Number of scopes between the call and the definition
+	chain         *Definition      // The definitions of the key in that scope, see guard.go
+	typeVariables map[string]Value // Bound by generic patterns
+}
+
+// appendCandidates adds a candidate for every scope visible from this one that defines the key.
+func (currentScope *Scope) appendCandidates(candidates []*candidate, definitionKey string, patterns []string, scores []int, rest bool) []*candidate {
+	depth := 0
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		if chain, found := searchScope.definitionsMap[definitionKey]; found {
+			candidates = append(candidates, &candidate{patterns: patterns, scores: scores, rest: rest, depth: depth, chain: chain})
+		}
+		depth++
+	}
+	return candidates
+}
+
+// beats reports whether the candidate is preferred over the other one.
+func (c *candidate) beats(other *candidate) bool {
+	if c.depth != other.depth {
+		return c.depth < other.depth
+	}
+	if c.rest != other.rest {
+		return !c.rest
+	}
+	better := false
+	for i, score := range c.scores {
+		if score > other.scores[i] {
+			return false
+		}
+		if score < other.scores[i] {
+			better = true
+		}
+	}
+	return better
+}
+
+// sortKey orders candidates so that every candidate comes after all candidates that beat it.
+func (c *candidate) sortKey() []int {
+	key := []int{c.depth, 0, 0}
+	if c.rest {
+		key[1] = 1
+	}
+	for _, score := range c.scores {
+		key[2] += score
+	}
+	return key
+}
+
+// resolve returns the most specific candidate definition whose guard passes, with the bound arguments,
+// or nil if none does. If several candidates are equally specific, an ambiguity error is raised.
+func (currentScope *Scope) resolve(macroName string, call *macroCall, candidates []*candidate, operatorToken *tokenizer.Token) (*Definition, *macroBinding) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].sortKey(), candidates[j].sortKey()
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	var best *candidate
+	var bestDefinition *Definition
+	var bestBinding *macroBinding
+	var tied []*Definition
+	for _, found := range candidates {
+		if best != nil && best.beats(found) {
+			continue
+		}
+		binding := call.bind(macroName, found.patterns, found.typeVariables, operatorToken)
+		for definition := found.chain; definition != nil; definition = definition.next {
+			if definition.guard != nil && !currentScope.guardPasses(definition, binding) {
+				continue
+			}
+			if best == nil {
+				best, bestDefinition, bestBinding = found, definition, binding
+			} else if definition != bestDefinition { // A generic key can also match as written
+				tied = append(tied, definition)
+			}
+			break
+		}
+	}
+
+	if len(tied) > 0 {
+		currentScope.raiseAmbiguous(macroName, call, append([]*Definition{bestDefinition}, tied...), operatorToken)
+	}
+	return bestDefinition, bestBinding
+}
+
+// raiseAmbiguous raises the error for a call matched by several equally specific definitions.
+func (currentScope *Scope) raiseAmbiguous(macroName string, call *macroCall, definitions []*Definition, operatorToken *tokenizer.Token) {
+	var lines []string
+	for _, definition := range definitions {
+		lines = append(lines, fmt.Sprintf("%s (defined at %s)",
+			formatSignature(strings.Split(definition.definitionName, " ")),
+			formatDefinitionLocation(definition.definitionToken),
+		))
+	}
+	panic(&Error{
+		Code: CodeAmbiguous,
+		Message: fmt.Sprintf("Ambiguous macro '%s', equally specific candidates:\n  - %s",
+			formatSignature(append([]string{macroName}, call.evaluatedTypeStrings()...)),
+			strings.Join(lines, "\n  - "),
+		),
+		BaseValue: BaseValue{Token: operatorToken},
+	})
+}
+
+// expand expands the definition chosen by resolve.
+func (currentScope *Scope) expand(macroName string, definition *Definition, binding *macroBinding, operatorToken *tokenizer.Token) Value {
+	defer currentScope.enterExpansion(macroName, binding.actualTypes, definition, operatorToken)()
+	for _, output := range binding.output {
+		output.replay(currentScope.interpreter)
+	}
+	return processMacro(definition, currentScope, binding)
+}
@@ -0,0 +1,127 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExactTypeBeatsFallback(t *testing.T) {
+	expectOutput(t, `
+small ::= $TYPEDEF(1, small, int)
+int ! int ::= $PRINTLN("int")
+small ! int ::= $PRINTLN("small")
+small ! 2
+1 ! 2
+`, "small", "int")
+}
+
+func TestTypedPatternBeatsWildcard(t *testing.T) {
+	expectOutput(t, `
+int ! (*) ::= $PRINTLN("wild")
+int ! int ::= $PRINTLN("typed")
+1 ! 2
+1 ! "text"
+`, "typed", "wild")
+}
+
+func TestInnerScopeWinsBetweenEqualPatterns(t *testing.T) {
+	expectOutput(t, `
+int ! int ::= $PRINTLN("outer")
+{
+  int ! int ::= $PRINTLN("inner")
+  1 ! 2
+}
+1 ! 2
+`, "inner", "outer")
+}
+
+func TestInnerScopeShadowsMoreSpecificOuterDefinition(t *testing.T) {
+	expectOutput(t, `
+int ! int ::= $PRINTLN("outer")
+{
+  int ! (*) ::= $PRINTLN("inner")
+  1 ! 2
+}
+1 ! 2
+`, "inner", "outer")
+}
+
+func TestIncomparableDefinitionsAreAmbiguous(t *testing.T) {
+	_, err := run(t, `
+small ::= $TYPEDEF(1, small, int)
+small ~ int ::= 1
+int ~ small ::= 2
+small ~ small
+`)
+	raised, ok := err.(*Error)
+	if !ok || raised.Code != CodeAmbiguous {
+		t.Fatalf("expected an ambiguity error, got %v", err)
+	}
+	for _, candidate := range []string{"small ~ int", "int ~ small"} {
+		if !strings.Contains(raised.Message, candidate) {
+			t.Errorf("error does not list %q:\n%s", candidate, raised.Message)
+		}
+	}
+}
+
+func TestRightWildcardEvaluatesOnce(t *testing.T) {
+	expectOutput(t, `
+int + (*) ::= {
+  $PRINTLN("wild")
+  $2
+}
+int + int ::= $PRINTLN("typed")
+1 + $PRINTLN("side")
+`, "side", "wild")
+}
+
+func TestRightWildcardAloneIsNotEvaluated(t *testing.T) {
+	expectOutput(t, `
+int + (*) ::= $PRINTLN("wild")
+1 + $PRINTLN("side")
+`, "wild")
+}
+
+func TestConcreteTypeArgumentIsNotATypeVariable(t *testing.T) {
+	expectOutput(t, `
+if ::= $TYPEDEF($NIL(), if)
+if(VALUE<I8>) ::= $PRINTLN("i8")
+if(VALUE<T>) ::= $PRINTLN("generic")
+if($TYPEDEF(1, VALUE<I32>))
+if($TYPEDEF(1, VALUE<I8>))
+`, "generic", "i8")
+}
+
+func TestConcreteTypeArgumentDoesNotMatchOtherTypes(t *testing.T) {
+	_, err := run(t, `
+if ::= $TYPEDEF($NIL(), if)
+if(VALUE<I8>) ::= $PRINTLN("i8")
+if($TYPEDEF(1, VALUE<I32>))
+`)
+	if err == nil || !strings.Contains(err.Error(), "No match") {
+		t.Errorf("expected no match for VALUE<I32>, got %v", err)
+	}
+}
+
+func TestListLiteralCanBeOverloaded(t *testing.T) {
+	expectOutput(t, `
+[int] ::= $PRINTLN("one int")
+[int, string] ::= $PRINTLN("pair")
+[5]
+[1, "a"]
+$PRINTLN(["a"])
+$PRINTLN([1, 2, 3])
+$PRINTLN([])
+`, "one int", "pair", "[a]", "[1, 2, 3]", "[]")
+}
+
+func TestCurlyCallPassesOneBlock(t *testing.T) {
+	expectOutput(t, `
+f ::= $TYPEDEF($NIL(), f)
+f{(*)} ::= $PRINTLN($QUOTE($2))
+f{
+  1
+  2
+}
+`, "(@begin 1 2)")
+}
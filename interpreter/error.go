@@ -2,57 +2,220 @@ package interpreter
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
 
+	"gismolang.org/compiler/parser"
 	"gismolang.org/compiler/tokenizer"
 )
 
-// RuntimeError prints a formatted error message with source context and exits.
+// Error codes identify the kind of a diagnostic in machine-readable output.
+const (
+	CodeSyntax          = "syntax"
+	CodeRuntime         = "runtime"
+	CodeNoMatch         = "no-match"
+	CodeAmbiguous       = "ambiguous"
+	CodeRaised          = "raised"
+	CodeUninterpretable = "uninterpretable"
+	CodeCancelled       = "cancelled"
+	CodeLoad            = "load"
+)
+
+// RuntimeError raises an Error value carrying the formatted message and the token it refers to.
+// The error unwinds the interpreter until it is caught by $TRY or reaches the top-level driver.
 func RuntimeError(token *tokenizer.Token, format string, a ...interface{}) {
-	message := fmt.Sprintf(format, a...)
-	fmt.Printf("Error: %s\n", message)
+	panic(&Error{
+		Code:      CodeRuntime,
+		Message:   fmt.Sprintf(format, a...),
+		BaseValue: BaseValue{Token: token},
+	})
+}
+
+// raiseAt raises an Error with the given code that spans all source code covered by the value.
+func raiseAt(code string, value Value, format string, a ...interface{}) {
+	start, end := valueSpan(value)
+	panic(&Error{
+		Code:      code,
+		Message:   fmt.Sprintf(format, a...),
+		BaseValue: BaseValue{Token: start},
+		End:       end,
+	})
+}
+
+// valueSpan returns the first and the last token of a value in its source.
+// The span of an expression is the code it was parsed from, even if macro arguments were substituted
+// into it since, so an error in a macro body does not underline the code at the call site.
+// Expressions built at runtime, such as $$, only span their operator.
+func valueSpan(value Value) (*tokenizer.Token, *tokenizer.Token) {
+	if consCell, ok := value.(*ConsCell); ok && consCell.First != nil {
+		return consCell.First, consCell.Last
+	}
+	token := value.GetToken()
+	if token == nil {
+		return nil, nil
+	}
+	return token, token
+}
+
+// sourceExtent returns the first and the last token of a freshly parsed expression in its source:
+// the extents of its operator and arguments, and its closing bracket if it has one.
+func sourceExtent(expression *ConsCell, closing *tokenizer.Token) (*tokenizer.Token, *tokenizer.Token) {
+	var first, last *tokenizer.Token
+	extend := func(start *tokenizer.Token, end *tokenizer.Token) {
+		if start == nil || start.Line == 0 || (first != nil && start.Source != first.Source) {
+			return
+		}
+		if first == nil || tokenBefore(start, first) {
+			first = start
+		}
+		if last == nil || tokenBefore(last, end) {
+			last = end
+		}
+	}
+	for cell := expression; cell != nil; cell, _ = cell.Cdr.(*ConsCell) {
+		extend(valueSpan(cell.Car))
+	}
+	extend(closing, closing)
+	return first, last
+}
 
-	if token != nil {
-		printErrorContext(token)
+func tokenBefore(a *tokenizer.Token, b *tokenizer.Token) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// catchError runs fn and returns the Error raised inside of it, if any.
+// Panics that are not Gismo errors are propagated unchanged.
+func catchError(fn func()) (raised *Error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err, ok := recovered.(*Error)
+			if !ok {
+				panic(recovered)
+			}
+			raised = err
+		}
+	}()
+	fn()
+	return nil
+}
+
+// RenderError writes an error message with source context and macro backtrace.
+func (interpreter *Interpreter) RenderError(w io.Writer, err error) {
+	fmt.Fprintf(w, "Error: %s\n", err.Error())
+
+	raised, ok := err.(*Error)
+	if ok && raised.Token != nil {
+		interpreter.renderErrorContext(w, raised.Token, raised.End)
 	} else {
-		fmt.Println("  (No source location available)")
+		fmt.Fprintln(w, "  (No source location available)")
 	}
+	if ok {
+		renderBacktrace(w, raised.Backtrace)
+	}
+}
+
+// Frames shown at each end of a long backtrace (e.g. deep macro recursion)
+const backtraceEdgeFrames = 10
 
-	os.Exit(1)
+func renderBacktrace(w io.Writer, backtrace []ExpansionFrame) {
+	for i, frame := range backtrace {
+		if len(backtrace) > 2*backtraceEdgeFrames && i == backtraceEdgeFrames {
+			fmt.Fprintf(w, "  ... %d more expansions ...\n", len(backtrace)-2*backtraceEdgeFrames)
+		}
+		if len(backtrace) > 2*backtraceEdgeFrames && i >= backtraceEdgeFrames && i < len(backtrace)-backtraceEdgeFrames {
+			continue
+		}
+		fmt.Fprintf(w, "  note: while expanding `%s` defined at %s, called at %s\n",
+			frame.Signature, formatDefinitionLocation(frame.DefinitionToken), formatLocation(frame.CallToken))
+	}
 }
 
-func printErrorContext(token *tokenizer.Token) {
-	fmt.Printf("%s:\n", token.Source)
+// formatDefinitionLocation renders source:line of a definition, or <builtin> if it has no token.
+func formatDefinitionLocation(token *tokenizer.Token) string {
+	if token == nil {
+		return "<builtin>"
+	}
+	return fmt.Sprintf("%s:%d", token.Source, token.Line)
+}
 
-	content, err := os.ReadFile(token.Source)
-	if err == nil {
-		lines := strings.Split(string(content), "\n")
-		lineIdx := token.Line - 1
+// RenderSyntaxErrors writes every parser diagnostic with source context.
+func (interpreter *Interpreter) RenderSyntaxErrors(w io.Writer, diagnostics []parser.Diagnostic) {
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintf(w, "Syntax Error: %s\n", diagnostic.Message())
+		interpreter.renderErrorContext(w, diagnostic.Token, nil)
+	}
+	fmt.Fprintf(w, "%d syntax error(s)\n", len(diagnostics))
+}
 
-		if lineIdx >= 0 && lineIdx < len(lines) {
-			codeLine := lines[lineIdx]
-			// Replace tabs with spaces for alignment calculation
-			cleanLine := strings.ReplaceAll(codeLine, "\t", "    ")
-			
-			fmt.Printf("%d: %s\n", token.Line, cleanLine)
+// Maximum number of source lines shown for an error spanning several lines
+const maxContextLines = 6
 
-			// Calculate padding
-			prefix := fmt.Sprintf("%d: ", token.Line)
-			paddingLen := len(prefix) + token.Column - 1
-			padding := strings.Repeat(" ", paddingLen)
+// renderErrorContext shows the source lines from the start token to the end token (nil for a single token)
+// and underlines the covered code. The code is taken from the sources registered while parsing,
+// so it matches what was actually compiled even for code that does not come from a file.
+func (interpreter *Interpreter) renderErrorContext(w io.Writer, start *tokenizer.Token, end *tokenizer.Token) {
+	fmt.Fprintf(w, "%s:\n", start.Source)
 
-			// Determine underline length
-			tokenLen := len(token.Value)
-			if tokenLen == 0 {
-				tokenLen = 1
-			}
-			underlines := strings.Repeat("^", tokenLen)
+	content, found := interpreter.sources[start.Source]
+	lines := strings.Split(content, "\n")
+	if !found || start.Line < 1 || start.Line > len(lines) {
+		// Fallback if the source is unknown
+		fmt.Fprintf(w, "  at Line %d, Column %d\n", start.Line, start.Column)
+		return
+	}
+	if end == nil || end.Source != start.Source || end.Line < start.Line || end.Line > len(lines) {
+		end = start
+	}
 
-			fmt.Printf("%s%s\n", padding, underlines)
+	gutterWidth := len(fmt.Sprint(end.Line))
+	for line := start.Line; line <= end.Line; line++ {
+		if end.Line-start.Line+1 > maxContextLines && line == start.Line+maxContextLines/2 {
+			fmt.Fprintf(w, "%s  ...\n", strings.Repeat(" ", gutterWidth))
+			line = end.Line - maxContextLines/2 + 1
+		}
+		codeLine := []rune(lines[line-1])
+
+		// Underline from the start column (or the first non-blank) to the end of the token (or line)
+		from := 0
+		for from < len(codeLine) && (codeLine[from] == ' ' || codeLine[from] == '\t') {
+			from++
+		}
+		to := len(codeLine)
+		if line == start.Line {
+			from = start.Column - 1
+		}
+		if line == end.Line {
+			to = end.Column - 1 + end.Width()
+		}
+		if to > len(codeLine) {
+			to = len(codeLine)
+		}
+		if to <= from {
+			to = from + 1
+		}
+
+		// Replace tabs with spaces and keep the underline aligned with the expanded line
+		prefix := fmt.Sprintf("%*d: ", gutterWidth, line)
+		padding := len(prefix) + expandedWidth(codeLine, from)
+		underline := expandedWidth(codeLine, to) - expandedWidth(codeLine, from)
+		if underline < 1 {
+			underline = 1
+		}
+
+		fmt.Fprintf(w, "%s%s\n", prefix, strings.ReplaceAll(string(codeLine), "\t", "    "))
+		fmt.Fprintf(w, "%s%s\n", strings.Repeat(" ", padding), strings.Repeat("^", underline))
+	}
+}
+
+// expandedWidth returns the display width of the first n runes of a line with tabs expanded to four spaces.
+func expandedWidth(line []rune, n int) int {
+	width := 0
+	for i := 0; i < n; i++ {
+		if i < len(line) && line[i] == '\t' {
+			width += 4
+		} else {
+			width++
 		}
-	} else {
-		// Fallback if file cannot be read
-		fmt.Printf("  at Line %d, Column %d\n", token.Line, token.Column)
 	}
-}
\ No newline at end of file
+	return width
+}
@@ -0,0 +1,77 @@
+package interpreter
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// expectSpan runs the code and fails the test unless it raises an error spanning the given lines.
+func expectSpan(t *testing.T, code string, startLine int, endLine int) {
+	t.Helper()
+	_, err := run(t, code)
+	raised, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an error, got %v", err)
+	}
+	if raised.Token.Line != startLine || raised.End.Line != endLine {
+		t.Errorf("expected lines %d to %d, got %d to %d", startLine, endLine, raised.Token.Line, raised.End.Line)
+	}
+}
+
+func TestSpanCoversClosingBrace(t *testing.T) {
+	expectSpan(t, "$RAISE({\n  1\n  2\n}, \"bad\")\n", 1, 4)
+}
+
+func TestSpanCoversClosingBracket(t *testing.T) {
+	expectSpan(t, "$RAISE([\n  1,\n  2\n], \"bad\")\n", 1, 4)
+}
+
+func TestSpanIgnoresSubstitutedArguments(t *testing.T) {
+	expectSpan(t, `fail ::= $TYPEDEF($NIL(), fail)
+fail(*) ::= $RAISE([$2, 1], "bad")
+fail({
+  1
+  2
+})
+`, 2, 2)
+}
+
+func TestSpanOfNestedExpansion(t *testing.T) {
+	expectSpan(t, `inner ::= $TYPEDEF($NIL(), inner)
+outer ::= $TYPEDEF($NIL(), outer)
+inner(*) ::= $RAISE($$, "bad")
+outer(*) ::= inner($2)
+outer({
+  1
+  2
+})
+`, 4, 4)
+}
+
+// cancelAfter is a context that is cancelled after its first n checks.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (ctx *cancelAfter) Err() error {
+	if ctx.n > 0 {
+		ctx.n--
+		return nil
+	}
+	return context.Canceled
+}
+
+func TestTryDoesNotCatchCancellation(t *testing.T) {
+	var stdout strings.Builder
+	interp := NewInterpreter(&cancelAfter{Context: context.Background(), n: 1}, nil, &stdout)
+	module, _ := interp.Parse("$TRY($WHILE(1, 1), e, $PRINTLN(\"caught\"))\n", "test.gsm")
+	err := interp.Run(module)
+	if raised, ok := err.(*Error); !ok || raised.Code != CodeCancelled {
+		t.Errorf("expected the cancellation to stop the compilation, got %v", err)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("expected $TRY not to catch the cancellation, got %q", stdout.String())
+	}
+}
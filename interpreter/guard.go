@@ -0,0 +1,72 @@
+package interpreter
+
+// A definition can be guarded with a where clause that is checked after its pattern matched:
+//
+//	int / int where $NOT($EQUALS($2, 0)) ::= $DIV($1, $2)
+//	int / int ::= $RAISE($2, "division by zero")
+//
+// The guard sees the same $1..$n, $... and $$ as the body. If it evaluates to Nil, the definition is
+// skipped and dispatch continues as if it did not exist: with the next definition of the same pattern,
+// then the same pattern in an enclosing scope, then the next fallback type. Guarded definitions of one
+// pattern in a scope are tried in the order they were defined, the unguarded one last.
+//
+// `where` only separates a guard in the head of a definition, i.e. when ::= follows it at the same
+// bracket depth (see the tokenizer). Anywhere else, as in f(a where b, c), it is an ordinary identifier.
+
+const guardKeyword = "where"
+
+// splitGuard separates a definition key `pattern where guard` into the pattern and the guard.
+// The guard is nil if the key has none.
+func splitGuard(defKey Value) (Value, Value) {
+	consCell, ok := defKey.(*ConsCell)
+	if !ok || consCell.Car.String() != guardKeyword || consCell.Length() != 3 {
+		return defKey, nil
+	}
+	return consCell.Get(1), consCell.Get(2)
+}
+
+// addDefinition adds the definition to this scope. It replaces the definition of the same pattern
+// with the same guard; otherwise a guarded definition is inserted after the other guarded ones.
+func (currentScope *Scope) addDefinition(definition *Definition) {
+	var chain []*Definition
+	for candidate := currentScope.definitionsMap[definition.definitionName]; candidate != nil; candidate = candidate.next {
+		chain = append(chain, candidate)
+	}
+
+	replaced := false
+	for i, candidate := range chain {
+		if guardString(candidate.guard) == guardString(definition.guard) {
+			chain[i] = definition
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		if definition.guard != nil && len(chain) > 0 && chain[len(chain)-1].guard == nil {
+			chain = append(chain[:len(chain)-1], definition, chain[len(chain)-1])
+		} else {
+			chain = append(chain, definition)
+		}
+	}
+
+	for i, candidate := range chain {
+		candidate.next = nil
+		if i+1 < len(chain) {
+			candidate.next = chain[i+1]
+		}
+	}
+	currentScope.definitionsMap[definition.definitionName] = chain[0]
+}
+
+func guardString(guard Value) string {
+	if guard == nil {
+		return ""
+	}
+	return guard.String()
+}
+
+// guardPasses evaluates the guard of the definition with the arguments of the call substituted.
+func (currentScope *Scope) guardPasses(definition *Definition, binding *macroBinding) bool {
+	guard := substituteArguments(definition.guard, binding)
+	return interpretExpression(guard, currentScope).GetTypeString() != "Nil"
+}
@@ -0,0 +1,20 @@
+package interpreter
+
+import "testing"
+
+func TestGuardFallsThroughToUnguarded(t *testing.T) {
+	expectOutput(t, `
+int / int where $NOT($EQUALS($2, 0)) ::= $DIV($1, $2)
+int / int ::= $RAISE($2, "division by zero")
+$PRINTLN(6 / 3)
+$PRINTLN($TRY(6 / 0))
+`, "2", "division by zero")
+}
+
+func TestWhereOutsideDefinitionHeadIsIdentifier(t *testing.T) {
+	expectOutput(t, `
+f ::= $TYPEDEF(0, f)
+f(*) ::= $PRINTLN($QUOTE($2))
+f(1 where 2, 3)
+`, "(, (where 1 2) 3)")
+}
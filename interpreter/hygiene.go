@@ -0,0 +1,93 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"gismolang.org/compiler/parser"
+)
+
+// Macros defined while hygiene is enabled with $HYGIENE(on) rename the symbols they bind to fresh
+// names on every expansion: those defined with ::= or $DEF, loop variables of $FOREACH, $LAMBDA
+// parameters and the error variable of $TRY. Code passed in through $1, $2 and $$ keeps its names, so a
+// symbol in an argument is never captured by a local of the macro body:
+//
+//	int |> (*) ::= { f ::= $1; $2 }
+//	f ::= 10
+//	1 |> f // evaluates the caller's f (10), not the macro's f (1)
+//
+// Fresh names contain a '.', which cannot appear in an identifier, so they never clash with user code.
+
+// gensym returns a symbol that has not been returned before by this interpreter.
+func (interpreter *Interpreter) gensym(prefix string) *Symbol {
+	interpreter.gensymCounter++
+	return &Symbol{Value: fmt.Sprintf("%s.%d", prefix, interpreter.gensymCounter)}
+}
+
+// binderPositions gives the argument of each builtin that names a symbol bound in its body.
+var binderPositions = map[string]int{
+	"$DEF":     0,
+	"$FOREACH": 1,
+	"$LAMBDA":  0,
+	"$TRY":     1,
+}
+
+// renameBinders returns a copy of the macro body in which every symbol it binds is replaced by a fresh symbol, together with all uses of that symbol in the body.
+func (interpreter *Interpreter) renameBinders(body Value) Value {
+	binders := make(map[string]bool)
+	collectBinders(body, binders)
+	if len(binders) == 0 {
+		return body
+	}
+
+	renames := make(map[string]string, len(binders))
+	for name := range binders {
+		renames[name] = interpreter.gensym(name).Value
+	}
+	return renameSymbols(body, renames)
+}
+
+// collectBinders adds the names of all symbols bound in the value, see binderPositions.
+// Placeholders and builtins (starting with '$') are never binders.
+func collectBinders(value Value, binders map[string]bool) {
+	consCell, ok := value.(*ConsCell)
+	if !ok {
+		return
+	}
+	switch consCell.Car.String() {
+	case "::=":
+		addBinder(consCell.Get(1), binders)
+	case parser.CallOperator:
+		if position, found := binderPositions[consCell.Get(1).String()]; found {
+			if arguments := getArgsList(consCell.Get(2)); position < len(arguments) {
+				addBinder(arguments[position], binders)
+			}
+		}
+	}
+	collectBinders(consCell.Car, binders)
+	collectBinders(consCell.Cdr, binders)
+}
+
+func addBinder(value Value, binders map[string]bool) {
+	if symbol, ok := value.(*Symbol); ok && !strings.HasPrefix(symbol.Value, "$") {
+		binders[symbol.Value] = true
+	}
+}
+
+func renameSymbols(value Value, renames map[string]string) Value {
+	switch v := value.(type) {
+	case *ConsCell:
+		return &ConsCell{
+			Car:       renameSymbols(v.Car, renames),
+			Cdr:       renameSymbols(v.Cdr, renames),
+			BaseValue: v.BaseValue,
+			First:     v.First,
+			Last:      v.Last,
+		}
+	case *Symbol:
+		if renamed, found := renames[v.Value]; found {
+			return &Symbol{Value: renamed, BaseValue: v.BaseValue}
+		}
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package interpreter
+
+import "testing"
+
+func TestHygieneRenamesAssignedLocals(t *testing.T) {
+	expectOutput(t, `
+$HYGIENE(on)
+int |> (*) ::= {
+  f ::= $1
+  $2
+}
+f ::= 10
+$PRINTLN(1 |> f)
+`, "10")
+}
+
+func TestHygieneRenamesForeachVariable(t *testing.T) {
+	expectOutput(t, `
+$HYGIENE(on)
+y ::= 7
+int times (*) ::= $FOREACH([1, 2], y, $PRINTLN($2))
+1 times y
+`, "7", "7")
+}
+
+func TestHygieneRenamesLambdaParameter(t *testing.T) {
+	expectOutput(t, `
+$HYGIENE(on)
+y ::= 7
+int apply (*) ::= {
+  g ::= $LAMBDA(y, $2)
+  g(1)
+}
+$PRINTLN(1 apply y)
+`, "7")
+}
+
+func TestHygieneRenamesTryVariable(t *testing.T) {
+	expectOutput(t, `
+$HYGIENE(on)
+e ::= 7
+int rescue (*) ::= $TRY($RAISE($1, "failed"), e, $2)
+$PRINTLN(1 rescue e)
+`, "7")
+}
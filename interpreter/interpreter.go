@@ -1,23 +1,144 @@
 package interpreter
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
 	"gismolang.org/compiler/parser"
+	"gismolang.org/compiler/tokenizer"
 )
-func Interpret(expressions *parser.SyntaxNode) {
-    sexpressions := syntaxNode2Value(expressions)
-    interpretModule(sexpressions)
+
+// Interpreter holds the complete state of one compilation.
+// Interpreters share nothing, so several of them can run concurrently in one process.
+type Interpreter struct {
+    ctx           context.Context
+    output        io.Writer // Target of $WRITE and $WRITEB
+    stdout        io.Writer // Target of $PRINT, $PRINTLN, $SCOPE and $SUGGEST
+    rootScope     *Scope
+    fileLoadCache map[loadCacheKey]Value
+    libraryPath   []string          // Roots searched by $LOAD (GISMO_PATH)
+    loadStack     []loadFrame       // Files currently being run by $LOAD, outermost first
+    sources       map[string]string // Code of every parsed source by name, used to render errors
+    precedences   *tokenizer.PrecedenceTable // Modified by $PRECEDENCE
+    iotaValue     int                        // Next value returned by $IOTA
+    gensymCounter int                        // Suffix of the last symbol created by $GENSYM or hygiene
+    hygiene       bool                       // Macros defined now rename their ::= locals ($HYGIENE)
+    naryNames     map[string]bool            // Macro names with n-ary or rest definitions
+    wildcardNames map[string]bool            // Macro names with a * as first argument pattern
+    genericNames  map[string]bool            // Macro names with a type variable in a pattern
+    subtyping     bool                       // A type hierarchy has been declared with $SUBTYPE
+    tracing       bool                       // Log every macro dispatch (--trace-expansion, $TRACE)
+    traceOutput   io.Writer
+    traceDepth    int
+    warnings         []Warning       // Reported with $WARN
+    disabledWarnings map[string]bool // Codes disabled with -Wno-<code>
+    warningsAsErrors bool            // -Werror
+    linearizations   map[linearizationKey]linearization // Cache of linearize, cleared by $SUBTYPE
 }
 
-func interpretModule(value Value) {
-    scope := NewEmptyScope()
+// NewInterpreter creates an interpreter with a fresh scope containing the builtins.
+// A nil writer discards everything written to it.
+func NewInterpreter(ctx context.Context, output io.Writer, stdout io.Writer) *Interpreter {
+    if output == nil {
+        output = io.Discard
+    }
+    if stdout == nil {
+        stdout = io.Discard
+    }
+    interpreter := &Interpreter{
+        ctx:         ctx,
+        output:      output,
+        stdout:      stdout,
+        traceOutput: io.Discard, // See SetTraceOutput
+        sources:     make(map[string]string),
+        disabledWarnings: make(map[string]bool),
+        libraryPath:      filepath.SplitList(os.Getenv(LibraryPathEnv)),
+    }
+    interpreter.Reset()
+    return interpreter
+}
 
+// Scope returns the top-level scope that all modules run in.
+func (interpreter *Interpreter) Scope() *Scope {
+    return interpreter.rootScope
+}
+
+// Parse tokenizes and parses code using the operator precedences currently
+// configured through $PRECEDENCE. The code is registered under the source name,
+// so errors can show it later even if it did not come from a file.
+func (interpreter *Interpreter) Parse(code string, source string) (*parser.SyntaxNode, []parser.Diagnostic) {
+    interpreter.sources[source] = code
+    tokens := tokenizer.TokenizeWithPrecedences(code, source, interpreter.precedences)
+    return parser.Parse(tokens, source)
+}
+
+// Run interprets a module in the top-level scope, so that several files can share their definitions.
+// An error raised and not caught by the program is returned as *Error.
+func (interpreter *Interpreter) Run(module *parser.SyntaxNode) error {
+    _, err := interpreter.Eval(module)
+    return err
+}
+
+// RunSource interprets a module like Run. If the source names a file, that file counts as loaded
+// while and after it runs: $LOAD_ONCE of it does nothing and $LOAD of it is reported as a cycle.
+func (interpreter *Interpreter) RunSource(module *parser.SyntaxNode, source string) error {
+    if canonicalPath, ok := canonicalFile(source); ok {
+        defer interpreter.rootScope.enterLoad(canonicalPath, nil)()
+    }
+    return interpreter.Run(module)
+}
+
+// Eval interprets a module like Run and returns the value of its last expression.
+func (interpreter *Interpreter) Eval(module *parser.SyntaxNode) (Value, error) {
+    sexpressions := syntaxNode2Value(module)
+    var result Value = &Nil{}
+    if raised := catchError(func() { result = interpretModule(sexpressions, interpreter.rootScope) }); raised != nil {
+        return nil, raised
+    }
+    return result, nil
+}
+
+// Reset discards all definitions, loaded files, operator precedences, warnings, $IOTA and $HYGIENE state.
+func (interpreter *Interpreter) Reset() {
+    interpreter.fileLoadCache = make(map[loadCacheKey]Value)
+    interpreter.warnings = nil
+    interpreter.precedences = tokenizer.NewPrecedenceTable()
+    interpreter.iotaValue = 0
+    interpreter.hygiene = false
+    interpreter.naryNames = make(map[string]bool)
+    interpreter.wildcardNames = make(map[string]bool)
+    interpreter.genericNames = make(map[string]bool)
+    interpreter.subtyping = false
+    interpreter.linearizations = nil
+    interpreter.rootScope = interpreter.newRootScope()
+}
+
+// checkCancelled raises an error once the context of the interpreter is done.
+// It is called at statement and loop boundaries so that runaway programs can be stopped.
+func (interpreter *Interpreter) checkCancelled(token *tokenizer.Token) {
+    if err := interpreter.ctx.Err(); err != nil {
+        panic(&Error{
+            Code:      CodeCancelled,
+            Message:   fmt.Sprintf("Compilation cancelled: %v", err),
+            BaseValue: BaseValue{Token: token},
+        })
+    }
+}
+
+func interpretModule(value Value, scope *Scope) Value {
+    var result Value = &Nil{}
     if consCell, ok := value.(*ConsCell); ok {
         length := consCell.Length()
         for i:=1; i < length; i++ {
             arg := consCell.Get(i);
-            interpretExpression(arg, scope);
+            scope.interpreter.checkCancelled(arg.GetToken())
+            result = interpretExpression(arg, scope);
         }
     }
+    return result
 }
 
 func interpretExpression(value Value, scope *Scope) Value {
@@ -25,7 +146,7 @@ func interpretExpression(value Value, scope *Scope) Value {
     case *ConsCell:
         operator := v.Get(0).String()
         switch operator {
-        case "@callCurly":
+        case parser.CurlyCallOperator:
              // ... [Logic remains unchanged] ...
              var result Value = &Nil{}
              arglen := v.Length()
@@ -37,30 +158,40 @@ func interpretExpression(value Value, scope *Scope) Value {
                  Cdr: &ConsCell{
                      Car: v.Get(1),
                      Cdr: &ConsCell{
-                         Car: &ConsCell{Car: &Symbol{Value: "@begin"}, Cdr: result},
+                         Car: &ConsCell{Car: &Symbol{Value: parser.BlockOperator}, Cdr: result},
                          Cdr: &Nil{},
                      },
                  },
              }
-        case "@call":
+        case parser.CallOperator:
             function := interpretExpression(v.Get(1), scope)
             arguments := v.Get(2)
+            if _, empty := arguments.(*Nil); empty {
+                // f() has no argument to point at, so errors about its arguments point at the call
+                arguments = &Nil{BaseValue: BaseValue{Token: v.Get(1).GetToken()}}
+            }
             if builtinFunction, ok := function.(BuiltinFunction); ok {
                 return builtinFunction.callback(arguments, scope)
             }
+        case parser.ListOperator:
+            // [a, b, c] is dispatched on its elements, with [...] ::= $... as the default (see newRootScope)
+            if v.Length() == 1 {
+                return &Vector{Elements: []Value{}, BaseValue: BaseValue{Token: v.GetToken()}}
+            }
         case "::=":
             scope.Define(v.Get(1), v.Get(2))
             return &Nil{}
-        case "@begin", "Module":
+        case parser.BlockOperator, "Module":
             // ... [Logic remains unchanged] ...
             var result Value = &Nil{}
             scope.allowExports = true
+            // Reset even if an error unwinds through this block and is caught by $TRY
+            defer func() { scope.allowExports = false }()
             newScope := NewScope(scope)
             arglen := v.Length()
             for i:=1; i < arglen; i++ {
                 result = interpretExpression(v.Get(i), newScope)
             }
-            scope.allowExports = false
             return result
         }
         
@@ -68,10 +199,12 @@ func interpretExpression(value Value, scope *Scope) Value {
         result := scope.Get(v)
         if result == nil {
             // IMPROVED ERROR HANDLING
-            RuntimeError(v.GetToken(), "Could not interpret expression: %s", v.String())
+            raiseAt(CodeUninterpretable, v, "Could not interpret expression: %s", v.String())
         }
 		
         return result
+    case *evaluatedCode:
+        return v.evaluate(scope)
     case *Symbol:
         result := scope.Get(v)
         if result == nil {
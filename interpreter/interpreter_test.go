@@ -0,0 +1,32 @@
+package interpreter
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// run interprets the code on a fresh interpreter and returns what it printed.
+func run(t *testing.T, code string) (string, error) {
+	t.Helper()
+	var stdout strings.Builder
+	interp := NewInterpreter(context.Background(), nil, &stdout)
+	module, syntaxErrors := interp.Parse(code, "test.gsm")
+	if len(syntaxErrors) > 0 {
+		t.Fatalf("syntax error: %s", syntaxErrors[0].Message())
+	}
+	err := interp.Run(module)
+	return stdout.String(), err
+}
+
+// expectOutput interprets the code and fails the test unless it prints the expected lines.
+func expectOutput(t *testing.T, code string, expected ...string) {
+	t.Helper()
+	output, err := run(t, code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := strings.Join(expected, "\n") + "\n"; output != want {
+		t.Errorf("output:\n%s\nwant:\n%s", output, want)
+	}
+}
@@ -0,0 +1,138 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+// LibraryPathEnv names the environment variable listing library roots searched by $LOAD.
+const LibraryPathEnv = "GISMO_PATH"
+
+// SetLibraryPath sets the library roots searched by $LOAD after the directory of the loading file.
+// It defaults to the list in GISMO_PATH.
+func (interpreter *Interpreter) SetLibraryPath(roots []string) {
+	interpreter.libraryPath = roots
+}
+
+// resolveLoadPath returns the canonical path of the file loaded with $LOAD(rawPath) at the call.
+// A relative path is looked up in the directory of the source containing the call, then in every
+// library root, and last in the working directory, where it was looked up before library roots
+// existed. Sources that are not files (e.g. GISMO_CODE or the REPL) start with the working directory.
+// If no candidate exists, an error listing every searched path is raised at the call.
+func (interpreter *Interpreter) resolveLoadPath(rawPath string, call Value) string {
+	var candidates []string
+	if filepath.IsAbs(rawPath) {
+		candidates = []string{rawPath}
+	} else {
+		baseDir := "."
+		if token := call.GetToken(); token != nil && isFile(token.Source) {
+			baseDir = filepath.Dir(token.Source)
+		}
+		candidates = append(candidates, filepath.Join(baseDir, rawPath))
+		for _, root := range interpreter.libraryPath {
+			if root != "" {
+				candidates = append(candidates, filepath.Join(root, rawPath))
+			}
+		}
+		if baseDir != "." {
+			candidates = append(candidates, filepath.Clean(rawPath))
+		}
+	}
+
+	for _, candidate := range candidates {
+		absPath, err := filepath.Abs(candidate)
+		if err != nil {
+			continue
+		}
+		if canonicalPath, err := filepath.EvalSymlinks(absPath); err == nil && isFile(canonicalPath) {
+			return canonicalPath
+		}
+	}
+
+	raiseAt(CodeLoad, call, "cannot load %s (searched: %s)", rawPath, strings.Join(candidates, ", "))
+	return ""
+}
+
+// loadCacheKey identifies a parsed file in the load cache. The same file parses differently once
+// $PRECEDENCE has changed the precedence table, so the table version is part of the key.
+type loadCacheKey struct {
+	path        string
+	precedences int // Version of the precedence table the file was parsed with
+}
+
+// loadFrame is a file that is being run by $LOAD.
+type loadFrame struct {
+	path      string
+	callToken *tokenizer.Token
+}
+
+func (frame loadFrame) String() string {
+	if frame.callToken == nil {
+		return fmt.Sprintf("%s (top-level source)", frame.path)
+	}
+	return fmt.Sprintf("%s (loaded at %s)", frame.path, formatLocation(frame.callToken))
+}
+
+// hasLoaded reports whether the file has been run by $LOAD in this scope or an enclosing one.
+func (currentScope *Scope) hasLoaded(canonicalPath string) bool {
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		if searchScope.loadedFiles[canonicalPath] {
+			return true
+		}
+	}
+	return false
+}
+
+// enterLoad marks the file as loaded in the scope and pushes it onto the load stack.
+// If the file is already being loaded, the cycle is raised as an error at the call together with
+// the include chain. The call is nil for a top-level source, see RunSource.
+// The returned function must be deferred to pop the file again.
+func (currentScope *Scope) enterLoad(canonicalPath string, call Value) func() {
+	interpreter := currentScope.interpreter
+	frame := loadFrame{path: canonicalPath}
+	if call != nil {
+		frame.callToken = call.GetToken()
+	}
+	for i, outer := range interpreter.loadStack {
+		if outer.path != canonicalPath || call == nil {
+			continue
+		}
+		var chain []string
+		for _, inner := range interpreter.loadStack[i:] {
+			chain = append(chain, inner.String())
+		}
+		chain = append(chain, frame.String())
+		raiseAt(CodeLoad, call, "cyclic $LOAD of %s\n\nInclude chain:\n  %s", canonicalPath, strings.Join(chain, "\n  -> "))
+	}
+
+	if currentScope.loadedFiles == nil {
+		currentScope.loadedFiles = make(map[string]bool)
+	}
+	currentScope.loadedFiles[canonicalPath] = true
+	interpreter.loadStack = append(interpreter.loadStack, frame)
+	return func() {
+		interpreter.loadStack = interpreter.loadStack[:len(interpreter.loadStack)-1]
+	}
+}
+
+// canonicalFile returns the canonical path of a source name if it names a file.
+func canonicalFile(source string) (string, bool) {
+	if !isFile(source) {
+		return "", false
+	}
+	absPath, err := filepath.Abs(source)
+	if err != nil {
+		return "", false
+	}
+	canonicalPath, err := filepath.EvalSymlinks(absPath)
+	return canonicalPath, err == nil
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
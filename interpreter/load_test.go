@@ -0,0 +1,40 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLoadReparsesAfterPrecedenceChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sum.gsm")
+	if err := os.WriteFile(path, []byte("$PRINTLN(1 + 2 * 3)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	load := "$LOAD(" + strconv.Quote(path) + ")\n"
+	expectOutput(t, `
+int + int ::= $ADD($1, $2)
+int * int ::= $MUL($1, $2)
+`+load+`$PRECEDENCE("+", 20)`+"\n"+load+load, "7", "9", "9")
+}
+
+func TestLoadFallsBackToWorkingDirectory(t *testing.T) {
+	workDir, sourceDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "lib.gsm"), []byte("$PRINTLN(\"lib\")\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(sourceDir, "main.gsm")
+	if err := os.WriteFile(main, []byte("$LOAD(\"lib.gsm\")\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(original)
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, "$LOAD("+strconv.Quote(main)+")\n", "lib")
+}
@@ -0,0 +1,136 @@
+package interpreter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Map is a mutable hash map created with $MAP(), or $MAP(key, value, ...) with initial entries:
+//
+//	functions ::= $MAP()
+//	$MAP_SET(functions, main, 0)
+//	$MAP_GET(functions, main)              // 0, Nil for a missing key
+//	$FOREACH(functions, name, $PRINTLN(name)) // Keys in insertion order
+//
+// Keys are strings, symbols and ints, compared by value; the string "a" and the symbol a are
+// different keys. Entries are iterated in the order they were first set, so output generated from a
+// map is deterministic. Setting an existing key keeps its position.
+
+// mapKey identifies a key by its kind and value.
+type mapKey struct {
+	kind  string
+	value string
+}
+
+func newMapKey(key Value) (mapKey, bool) {
+	switch key := key.(type) {
+	case *String:
+		return mapKey{kind: "string", value: key.Value}, true
+	case *Symbol:
+		return mapKey{kind: "symbol", value: key.Value}, true
+	case *Integer:
+		return mapKey{kind: "int", value: strconv.FormatInt(key.Value, 10)}, true
+	}
+	return mapKey{}, false
+}
+
+type mapEntry struct {
+	key     Value
+	value   Value
+	deleted bool
+}
+
+type Map struct {
+	BaseValue
+	entries []mapEntry     // In insertion order, including deleted ones until compacted
+	index   map[mapKey]int // Position of each live key in entries
+}
+
+func NewMap() *Map {
+	return &Map{index: make(map[mapKey]int)}
+}
+
+func (m *Map) GetTypeString() string { return "Map" }
+func (m *Map) String() string {
+	var entries []string
+	for _, entry := range m.entries {
+		if !entry.deleted {
+			entries = append(entries, entry.key.String()+": "+entry.value.String())
+		}
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+func (m *Map) Length() int { return len(m.index) }
+
+// Get returns the value of the key, and whether the key is present.
+func (m *Map) Get(key mapKey) (Value, bool) {
+	if position, found := m.index[key]; found {
+		return m.entries[position].value, true
+	}
+	return nil, false
+}
+
+// Set sets the value of the key, appending the key if it is new.
+func (m *Map) Set(key mapKey, keyValue Value, value Value) {
+	if position, found := m.index[key]; found {
+		m.entries[position].value = value
+		return
+	}
+	m.index[key] = len(m.entries)
+	m.entries = append(m.entries, mapEntry{key: keyValue, value: value})
+}
+
+// Delete removes the key and returns its value, or nil if it is not present.
+func (m *Map) Delete(key mapKey) Value {
+	position, found := m.index[key]
+	if !found {
+		return nil
+	}
+	removed := m.entries[position].value
+	m.entries[position] = mapEntry{deleted: true}
+	delete(m.index, key)
+	if len(m.entries) > 2*len(m.index)+8 {
+		m.compact()
+	}
+	return removed
+}
+
+// Keys returns the keys in insertion order.
+func (m *Map) Keys() []Value {
+	keys := make([]Value, 0, len(m.index))
+	for _, entry := range m.entries {
+		if !entry.deleted {
+			keys = append(keys, entry.key)
+		}
+	}
+	return keys
+}
+
+// compact drops deleted entries.
+func (m *Map) compact() {
+	live := m.entries[:0]
+	for _, entry := range m.entries {
+		if !entry.deleted {
+			key, _ := newMapKey(entry.key)
+			m.index[key] = len(live)
+			live = append(live, entry)
+		}
+	}
+	for i := len(live); i < len(m.entries); i++ {
+		m.entries[i] = mapEntry{}
+	}
+	m.entries = live
+}
+
+// mapArguments evaluates the map and key arguments of a $MAP_ builtin.
+// It raises an error if the key cannot be used as a map key; a missing or non-map first argument gives nil.
+func mapArguments(argsList []Value, scope *Scope) (*Map, mapKey, Value) {
+	mapVal := interpretExpression(argsList[0], scope)
+	keyVal := interpretExpression(argsList[1], scope)
+	key, ok := newMapKey(keyVal)
+	if !ok {
+		raiseAt(CodeRuntime, argsList[1], "Map keys must be strings, symbols or ints, got %s", keyVal.GetTypeString())
+	}
+	m, _ := mapVal.(*Map)
+	return m, key, keyVal
+}
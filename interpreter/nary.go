@@ -0,0 +1,130 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"gismolang.org/compiler/parser"
+	"gismolang.org/compiler/tokenizer"
+)
+
+// Macros with three or more arguments are matched on all of them:
+//
+//	f(int, int, int) ::= $ADD($2, $ADD($3, $4))    // key "@call f int int int"
+//	f(int, ...) ::= $FOREACH($..., x, $PRINTLN(x)) // key "@call f int ..."
+//
+// The comma separated arguments of f(...) and f[...] are flattened, so the callee is $1 and the
+// arguments are $2..$n. A curly call f{...} is not: its statements are wrapped in one block, which is
+// $2. A trailing ... in a pattern matches any number of further arguments, which are evaluated and
+// bound to $... as a Vector. A * matches any argument without evaluating it.
+
+const (
+	restPattern     = "..."
+	restPlaceholder = "$..."
+	wildcardRank    = 1 << 16          // Score of an argument matched by *, after every concrete type
+	restRank        = wildcardRank + 1 // Score of an argument matched by ...
+)
+
+// isCallForm reports whether the operator applies a callee to a comma separated argument list.
+func isCallForm(name string) bool {
+	return name == parser.CallOperator || name == parser.CurlyCallOperator || name == parser.IndexOperator
+}
+
+func isCommaList(value Value) bool {
+	consCell, ok := value.(*ConsCell)
+	return ok && consCell.Car.String() == ","
+}
+
+// expressionArguments returns the arguments of a macro call expression.
+// The comma separated arguments of f(...) and f[...] are flattened: f(a, b, c) has the arguments f, a, b
+// and c. So are the elements of a list: [a, b] has the arguments a and b.
+func expressionArguments(expression *ConsCell) []Value {
+	var arguments []Value
+	for i := 1; i < expression.Length(); i++ {
+		arguments = append(arguments, expression.Get(i))
+	}
+	if isCallForm(expression.Car.String()) && len(arguments) == 2 && isCommaList(arguments[1]) {
+		return append(arguments[:1], getArgsList(arguments[1])...)
+	}
+	if expression.Car.String() == parser.ListOperator && len(arguments) == 1 && isCommaList(arguments[0]) {
+		return getArgsList(arguments[0]) // [a, b, c] has the arguments a, b and c
+	}
+	return arguments
+}
+
+// isNaryKey reports whether a definition key is dispatched by findNaryDefinition.
+func isNaryKey(parts []string) bool {
+	return len(parts) >= 4 || (len(parts) >= 2 && parts[len(parts)-1] == restPattern)
+}
+
+// matchCandidate checks the argument patterns of a definition key against the call and returns a
+// candidate with how well each argument matched (see dispatch.go), or nil if the key does not match.
+// Rest patterns match any call that is long enough, other keys only calls with as many arguments.
+func (call *macroCall) matchCandidate(patterns []string, depth int, chain *Definition) *candidate {
+	rest := len(patterns) > 0 && patterns[len(patterns)-1] == restPattern
+	fixed := patterns
+	if rest {
+		fixed = patterns[:len(patterns)-1]
+		if len(fixed) > len(call.raw) {
+			return nil
+		}
+	} else if len(fixed) != len(call.raw) {
+		return nil
+	}
+
+	found := &candidate{
+		patterns:      append([]string{}, patterns...),
+		scores:        make([]int, len(call.raw)),
+		rest:          rest,
+		depth:         depth,
+		chain:         chain,
+		typeVariables: make(map[string]Value),
+	}
+	for i := range found.scores {
+		if i >= len(fixed) {
+			found.scores[i] = restRank
+			continue
+		}
+		score, pattern, ok := call.matchPattern(i, fixed[i], found.typeVariables)
+		if !ok {
+			return nil
+		}
+		found.scores[i], found.patterns[i] = score, pattern
+	}
+	return found
+}
+
+// findNaryDefinition returns the most specific n-ary or rest definition for the call whose guard
+// passes, together with the bound arguments, or nil if none matches.
+func (currentScope *Scope) findNaryDefinition(macroName string, call *macroCall, operatorToken *tokenizer.Token) (*Definition, *macroBinding) {
+	var candidates []*candidate
+	searchPrefix := macroName + " "
+	depth := 0
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		for key, chain := range searchScope.definitionsMap {
+			if !strings.HasPrefix(key, searchPrefix) {
+				continue
+			}
+			parts := strings.Split(key, " ")
+			if !isNaryKey(parts) {
+				continue
+			}
+			if found := call.matchCandidate(parts[1:], depth, chain); found != nil {
+				candidates = append(candidates, found)
+			}
+		}
+		depth++
+	}
+	return currentScope.resolve(macroName, call, candidates, operatorToken)
+}
+
+// raiseNoNaryMatch raises the error for a call with three or more arguments that no definition matches.
+func (currentScope *Scope) raiseNoNaryMatch(macroName string, call *macroCall, operatorToken *tokenizer.Token) {
+	argTypes := call.typeStrings()
+	panic(&Error{
+		Code:        CodeNoMatch,
+		Message:     fmt.Sprintf("No match for macro '%s'", formatSignature(append([]string{macroName}, argTypes...))),
+		Suggestions: currentScope.getMacroSuggestions(macroName, argTypes...),
+		BaseValue:   BaseValue{Token: operatorToken},
+	})
+}
@@ -0,0 +1,109 @@
+package interpreter
+
+import (
+	"strings"
+
+	"gismolang.org/compiler/parser"
+)
+
+// $RECORD(Function, name, returnType, arguments, addr) declares a record type in the current scope:
+//
+//	fn ::= Function(main, w, [], 0)  // The constructor takes one value per field
+//	fn.name                          // main, through Function.(*) ::= $FIELD($1, $2)
+//	$WITH(fn, name, start)           // A copy with one field replaced
+//
+// The type string of a record is its record name, so `Function + int` and `Function.(*)` dispatch on it.
+// Fields are found by an index built once per record type.
+
+// recordType is the name and fields of a record type declared with $RECORD.
+type recordType struct {
+	name   string
+	fields []string
+	index  map[string]int // Position of each field
+}
+
+type Record struct {
+	BaseValue
+	recordType *recordType
+	Values     []Value // One per field, in declaration order
+}
+
+func (record *Record) GetTypeString() string { return record.recordType.name }
+func (record *Record) String() string {
+	fields := make([]string, len(record.Values))
+	for i, value := range record.Values {
+		fields[i] = record.recordType.fields[i] + ": " + value.String()
+	}
+	return record.recordType.name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Field returns the value of the field, and whether the record has it.
+func (record *Record) Field(field string) (Value, bool) {
+	if position, found := record.recordType.index[field]; found {
+		return record.Values[position], true
+	}
+	return nil, false
+}
+
+// With returns a copy of the record with the field set to the value.
+func (record *Record) With(field string, value Value) (*Record, bool) {
+	position, found := record.recordType.index[field]
+	if !found {
+		return nil, false
+	}
+	values := append([]Value{}, record.Values...)
+	values[position] = value
+	return &Record{recordType: record.recordType, Values: values, BaseValue: record.BaseValue}, true
+}
+
+// declareRecord defines the constructor of the record type and its .field access in this scope.
+func (currentScope *Scope) declareRecord(name Value, fields []Value) {
+	declared := &recordType{name: name.String(), index: make(map[string]int)}
+	for _, field := range fields {
+		fieldName := field.String()
+		if _, found := declared.index[fieldName]; found {
+			raiseAt(CodeRuntime, field, "Record %s declares the field '%s' twice", declared.name, fieldName)
+		}
+		declared.index[fieldName] = len(declared.fields)
+		declared.fields = append(declared.fields, fieldName)
+	}
+
+	currentScope.Define(name, BuiltinFunction{
+		callback: func(args Value, scope *Scope) Value {
+			argsList := getArgsList(args)
+			if len(argsList) != len(declared.fields) {
+				raiseAt(CodeRuntime, args, "Record %s has %d fields, got %d values", declared.name, len(declared.fields), len(argsList))
+			}
+			values := make([]Value, len(argsList))
+			for i, argument := range argsList {
+				values[i] = interpretExpression(argument, scope)
+			}
+			return &Record{recordType: declared, Values: values, BaseValue: BaseValue{Token: args.GetToken()}}
+		},
+		identifier: declared.name,
+	})
+
+	// Name.(*) ::= $FIELD($1, $2)
+	token := name.GetToken()
+	symbol := func(value string) Value { return &Symbol{Value: value, BaseValue: BaseValue{Token: token}} }
+	currentScope.Define(
+		wholeExpression(".", token, symbol(declared.name), symbol("*")),
+		wholeExpression(parser.CallOperator, token, symbol("$FIELD"), wholeExpression(",", token, symbol("$1"), symbol("$2"))),
+	)
+}
+
+// recordArguments evaluates the record argument of $FIELD and $WITH and returns the field name,
+// which is not evaluated.
+func recordArguments(argsList []Value, scope *Scope) (*Record, string) {
+	recordVal := interpretExpression(argsList[0], scope)
+	record, ok := recordVal.(*Record)
+	if !ok {
+		raiseAt(CodeRuntime, argsList[0], "Expected a record, got %s", recordVal.GetTypeString())
+	}
+	return record, argsList[1].String()
+}
+
+func raiseNoField(record *Record, field string, at Value) {
+	raiseAt(CodeRuntime, at, "Record %s has no field '%s', fields are: %s",
+		record.recordType.name, field, strings.Join(record.recordType.fields, ", "))
+}
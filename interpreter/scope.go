@@ -5,12 +5,18 @@ import (
 	"sort"
 	"strings"
 
+	"gismolang.org/compiler/parser"
 	"gismolang.org/compiler/tokenizer"
 )
 
 type Definition struct {
     definitionName  string
     definitionValue Value
+    definitionToken *tokenizer.Token // Token of the definition key, nil for builtins
+    doc             string           // Text of the /// doc comment preceding the definition
+    hygienic        bool             // Defined under $HYGIENE(on): binders are renamed on expansion
+    guard           Value            // Condition of a `where` clause, nil if unguarded
+    next            *Definition      // Next candidate with the same key in this scope, see guard.go
 }
 
 type Scope struct {
@@ -18,6 +24,10 @@ type Scope struct {
     definitionsMap map[string]*Definition
     localBindings  map[string]Value
     allowExports   bool
+    interpreter    *Interpreter
+    loadedFiles    map[string]bool // Canonical paths run by $LOAD in this scope
+    supertypes     map[string][]string // Direct supertypes declared with $SUBTYPE in this scope
+    typedRightKeys map[string]bool // "op L" of the definitions `L op R` with a typed R, see wildcard.go
 }
 
 func NewScope(parentScope *Scope) *Scope {
@@ -26,14 +36,22 @@ func NewScope(parentScope *Scope) *Scope {
         definitionsMap: make(map[string]*Definition),
         localBindings:  make(map[string]Value),
         allowExports:   false,
+        interpreter:    parentScope.interpreter,
     }
 }
 
-func NewEmptyScope() *Scope {
-    newScope := NewScope(nil)
+// newRootScope creates a scope without parent that only contains the builtins.
+func (interpreter *Interpreter) newRootScope() *Scope {
+    newScope := &Scope{
+        definitionsMap: make(map[string]*Definition),
+        localBindings:  make(map[string]Value),
+        interpreter:    interpreter,
+    }
     for _, builtinSymbol := range Builtins() {
         newScope.Define(&Symbol{Value: builtinSymbol.identifier}, builtinSymbol)
     }
+    // [...] ::= $..., so that [a, b, c] is a Vector unless a definition such as [int, int] overloads it
+    newScope.Define(wholeExpression(parser.ListOperator, nil, &Symbol{Value: restPattern}), &Symbol{Value: restPlaceholder})
     return newScope
 }
 
@@ -66,7 +84,7 @@ func (currentScope *Scope) SetLocal(localKey Value, localValue Value) {
         currentScope.parentScope.SetLocal(localKey, localValue)
         return
     }
-    panic(fmt.Sprintf("No existing local for '%s'", localKeyString))
+    RuntimeError(localKey.GetToken(), "No existing local for '%s'", localKeyString)
 }
 
 func (currentScope *Scope) GetLocal(localKey Value) Value {
@@ -85,11 +103,24 @@ func (currentScope *Scope) Get(lookupValue Value) Value {
     case *ConsCell:
         macroName := typedValue.Car.String()
         operatorToken := typedValue.Car.GetToken()
+        call := newMacroCall(currentScope, expressionArguments(typedValue))
 
+        if len(call.raw) >= 3 && currentScope.interpreter.naryNames[macroName] {
+            if definition, binding := currentScope.findNaryDefinition(macroName, call, operatorToken); definition != nil {
+                return currentScope.expand(macroName, definition, binding, operatorToken)
+            }
+        }
+
+        if macroName == parser.ListOperator && len(call.raw) == 2 {
+            return currentScope.applyBinaryMacro(macroName, call, operatorToken)
+        }
         if typedValue.Length() == 2 {
-            return currentScope.applyUnaryMacro(macroName, typedValue.Get(1), operatorToken)
+            return currentScope.applyUnaryMacro(macroName, call, operatorToken)
         } else if typedValue.Length() >= 3 {
-            return currentScope.applyBinaryMacro(macroName, typedValue.Get(1), typedValue.Get(2), operatorToken)
+            // Several arguments of a call form fall back to a definition taking the raw list, e.g. f(*)
+            binaryCall := newMacroCall(currentScope, []Value{typedValue.Get(1), typedValue.Get(2)})
+            binaryCall.values[0] = call.values[0]
+            return currentScope.applyBinaryMacro(macroName, binaryCall, operatorToken)
         }
         return nil
 
@@ -104,14 +135,157 @@ func (currentScope *Scope) Get(lookupValue Value) Value {
 // Define sets or updates a definition in this scope.
 // If the definition key is a single symbol, interpret its value immediately.
 func (currentScope *Scope) Define(defKey Value, defValue Value) {
+    defKey, guard := splitGuard(unwrapAll(defKey))
     definitionLookupKey := generateKey(defKey)
     if !strings.Contains(definitionLookupKey, " ") {
+        if guard != nil {
+            raiseAt(CodeRuntime, guard, "Only macro patterns can have a '%s' guard, '%s' is a symbol", guardKeyword, definitionLookupKey)
+        }
         defValue = interpretExpression(defValue, currentScope)
     }
-    currentScope.definitionsMap[definitionLookupKey] = &Definition{
+    if parts := strings.Split(definitionLookupKey, " "); isNaryKey(parts) {
+        currentScope.interpreter.naryNames[parts[0]] = true
+    } else if len(parts) >= 2 && parts[1] == "*" {
+        currentScope.interpreter.wildcardNames[parts[0]] = true
+    }
+    if parts := strings.Split(definitionLookupKey, " "); len(parts) >= 2 && containsGenericPattern(parts[1:]) {
+        currentScope.interpreter.genericNames[parts[0]] = true
+    }
+    if parts := strings.Split(definitionLookupKey, " "); len(parts) == 3 && parts[2] != "*" {
+        if currentScope.typedRightKeys == nil {
+            currentScope.typedRightKeys = make(map[string]bool)
+        }
+        currentScope.typedRightKeys[parts[0]+" "+parts[1]] = true
+    }
+    currentScope.addDefinition(&Definition{
         definitionName:  definitionLookupKey,
         definitionValue: defValue,
+        definitionToken: defKey.GetToken(),
+        doc:             findDoc(defKey),
+        hygienic:        currentScope.interpreter.hygiene,
+        guard:           guard,
+    })
+}
+
+// findDoc returns the first doc comment attached to a token of the value.
+func findDoc(value Value) string {
+    if token := value.GetToken(); token != nil && token.Doc != "" {
+        return token.Doc
+    }
+    if consCell, ok := value.(*ConsCell); ok {
+        if doc := findDoc(consCell.Car); doc != "" {
+            return doc
+        }
+        if consCell.Cdr != nil {
+            return findDoc(consCell.Cdr)
+        }
     }
+    return ""
+}
+
+// DefinitionInfo describes a ::= definition for tooling such as the language server.
+type DefinitionInfo struct {
+    Key       string           // Lookup key, e.g. "+ int int"
+    Signature string           // Readable form, e.g. "int + int"
+    Value     string           // The (unexpanded) body of the definition
+    Token     *tokenizer.Token // Where the definition was made, nil for builtins
+    Doc       string           // Text of the /// doc comment preceding the definition
+}
+
+// LookupDefinitions returns all definitions visible from this scope whose symbol or macro name is name.
+// Definitions shadowed by an inner scope are left out.
+func (currentScope *Scope) LookupDefinitions(name string) []DefinitionInfo {
+    var infos []DefinitionInfo
+    seen := make(map[string]bool)
+    for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+        for key, definition := range searchScope.definitionsMap {
+            if seen[key] || definedName(key) != name {
+                continue
+            }
+            seen[key] = true
+            for ; definition != nil; definition = definition.next {
+                signature := formatSignature(strings.Split(key, " "))
+                if definition.guard != nil {
+                    signature += " " + guardKeyword + " " + definition.guard.String()
+                }
+                infos = append(infos, DefinitionInfo{
+                    Key:       key,
+                    Signature: signature,
+                    Value:     definition.definitionValue.String(),
+                    Token:     definition.definitionToken,
+                    Doc:       definition.doc,
+                })
+            }
+        }
+    }
+    sort.SliceStable(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+    return infos
+}
+
+// DefinedNames returns the names of all symbols (including builtins) and macros visible from this scope.
+func (currentScope *Scope) DefinedNames() []string {
+    var names []string
+    seen := make(map[string]bool)
+    for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+        for key := range searchScope.definitionsMap {
+            name := definedName(key)
+            if !seen[name] {
+                seen[name] = true
+                names = append(names, name)
+            }
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+// MacroSuggestions returns the signatures of macros named macroName that best fit the argument types.
+// Without argument types every macro of that name is returned.
+func (currentScope *Scope) MacroSuggestions(macroName string, argTypes ...string) []string {
+    suggestions := currentScope.getMacroSuggestions(macroName, argTypes...)
+    if len(argTypes) == 0 {
+        for _, info := range currentScope.LookupDefinitions(macroName) {
+            if parts := strings.Split(info.Key, " "); len(parts) > 2 && isCallForm(parts[0]) {
+                suggestions = appendMissing(suggestions, formatSignature(parts))
+            }
+        }
+    }
+    return suggestions
+}
+
+// definedName returns the symbol or macro name a definition key defines. Call forms such as
+// `@call f int` are keyed by the form, but define a macro named by the callee.
+func definedName(key string) string {
+    parts := strings.Split(key, " ")
+    if len(parts) > 2 && isCallForm(parts[0]) {
+        return parts[1]
+    }
+    return parts[0]
+}
+
+// formatSignature renders the parts of a definition key the way the macro is written in code.
+func formatSignature(parts []string) string {
+    if parts[0] == parser.ListOperator {
+        return "[" + strings.Join(parts[1:], ", ") + "]"
+    }
+    switch len(parts) {
+    case 2:
+        return fmt.Sprintf("%s %s", parts[0], parts[1])
+    case 3:
+        switch parts[0] {
+        case parser.CallOperator:
+            return fmt.Sprintf("%s(%s)", parts[1], parts[2])
+        case parser.IndexOperator:
+            return fmt.Sprintf("%s[%s]", parts[1], parts[2])
+        case parser.CurlyCallOperator:
+            return fmt.Sprintf("%s{%s}", parts[1], parts[2])
+        }
+        return fmt.Sprintf("%s %s %s", parts[1], parts[0], parts[2])
+    }
+    if len(parts) > 3 && isCallForm(parts[0]) {
+        return formatSignature([]string{parts[0], parts[1], strings.Join(parts[2:], ", ")})
+    }
+    return strings.Join(parts, " ")
 }
 
 func (currentScope *Scope) String() string {
@@ -179,9 +353,14 @@ func (currentScope *Scope) getMacroSuggestions(macroName string, argTypes ...str
                 score := 0
                 formatted := ""
 
+                // Without argument types (e.g. for completion) every arity is listed
+                if len(argTypes) == 0 {
+                    formatted = formatSignature(parts)
+                }
+
                 // Unary: OP TYPE
                 if len(parts) == 2 && len(argTypes) == 1 {
-                    formatted = fmt.Sprintf("%s %s", parts[0], parts[1])
+                    formatted = formatSignature(parts)
                     // Base score for existence
                     score = 1 
                 } 
@@ -193,16 +372,20 @@ func (currentScope *Scope) getMacroSuggestions(macroName string, argTypes ...str
                     userLeft := argTypes[0]
                     userRight := argTypes[1]
 
-                    if parts[0] == "@call" {
-                        formatted = fmt.Sprintf("%s(%s)", defLeft, defRight)
-                    } else if parts[0] == "@curlyCall" {
-                        formatted = fmt.Sprintf("%s{%s}", defLeft, defRight)
-                    } else {
-                        formatted = fmt.Sprintf("%s %s %s", defLeft, parts[0], defRight)
-                    }
+                    formatted = formatSignature(parts)
                     
-                    if defLeft == userLeft { score += 2 }   // Prioritize Left Match
-                    if defRight == userRight { score += 1 } // Secondary Right Match
+                    if defLeft == userLeft || defLeft == "*" { score += 2 }    // Prioritize Left Match
+                    if defRight == userRight || defRight == "*" { score += 1 } // Secondary Right Match
+                }
+
+                // N-ary: NAME ARG1 ... ARGN, or a rest pattern NAME ARG1 ... ...
+                if len(argTypes) >= 3 && isNaryKey(parts) {
+                    formatted = formatSignature(parts)
+                    for i, defType := range parts[1:] {
+                        if i < len(argTypes) && defType == argTypes[i] {
+                            score++
+                        }
+                    }
                 }
 
                 if formatted != "" {
@@ -232,7 +415,7 @@ func (currentScope *Scope) getMacroSuggestions(macroName string, argTypes ...str
     for _, c := range candidates {
         // If we found relevant matches, hide the irrelevant (score 0) ones.
         // If we found NO relevant matches, show whatever we have (fallback).
-        if hasRelevantMatches && len(argTypes) == 2 && c.score == 0 {
+        if hasRelevantMatches && len(argTypes) >= 2 && c.score == 0 {
             continue
         }
         
@@ -246,99 +429,92 @@ func (currentScope *Scope) getMacroSuggestions(macroName string, argTypes ...str
     return final
 }
 
-func (currentScope *Scope) applyUnaryMacro(macroName string, rawLeft Value, operatorToken *tokenizer.Token) Value {
-    leftVal := interpretExpression(rawLeft, currentScope)
-    leftTypes := gatherTypeStrings(leftVal)
-
-    for _, leftType := range leftTypes {
-        defKey := macroName + " " + leftType
-        if foundDef := currentScope.findDefinition(defKey); foundDef != nil {
-            resolvedLeft := resolveValueForType(leftVal, leftType)
-
-            // Construct $$ -> (OP LEFT)
-            wholeExpr := &ConsCell{
-                Car: &Symbol{Value: macroName, BaseValue: BaseValue{Token: operatorToken}},
-                Cdr: &ConsCell{
-                    Car: resolvedLeft,
-                    Cdr: &Nil{},
-                },
-                BaseValue: BaseValue{Token: operatorToken},
-            }
-
-            return processMacro(foundDef.definitionValue, currentScope, resolvedLeft, &Nil{}, wholeExpr)
-        }
+func (currentScope *Scope) applyUnaryMacro(macroName string, call *macroCall, operatorToken *tokenizer.Token) Value {
+    // How the candidates are ranked is described in dispatch.go
+    if currentScope.interpreter.wildcardNames[macroName] {
+        call.recording = true
+        defer call.writeOutput()
+    }
+    var patterns []typePattern
+    if currentScope.needsLeftValue(macroName, 1) {
+        patterns = currentScope.typePatterns(call.value(0))
+    }
+    if currentScope.interpreter.wildcardNames[macroName] {
+        patterns = append(patterns, typePattern{name: "*", score: wildcardRank})
     }
 
-    // Error generation with smart suggestions
-    errorMsg := fmt.Sprintf("No match for unary macro '%s %s'", macroName, leftVal.GetTypeString())
-    
-    suggestions := currentScope.getMacroSuggestions(macroName, leftVal.GetTypeString())
-    if len(suggestions) > 0 {
-        errorMsg += fmt.Sprintf("\n\nDid you mean one of these?\n  - %s", strings.Join(suggestions, "\n  - "))
+    var candidates []*candidate
+    for _, pattern := range patterns {
+        candidates = currentScope.appendCandidates(candidates, macroName+" "+pattern.name, []string{pattern.name}, []int{pattern.score}, false)
+    }
+    candidates = currentScope.appendGenericCandidates(candidates, macroName, call)
+    if definition, binding := currentScope.resolve(macroName, call, candidates, operatorToken); definition != nil {
+        return currentScope.expand(macroName, definition, binding, operatorToken)
     }
 
-    RuntimeError(operatorToken, errorMsg)
+    if definition, binding := currentScope.findNaryDefinition(macroName, call, operatorToken); definition != nil {
+        return currentScope.expand(macroName, definition, binding, operatorToken)
+    }
 
-    return nil
+    // Error generation with smart suggestions
+    leftVal := call.value(0)
+    panic(&Error{
+        Code:        CodeNoMatch,
+        Message:     fmt.Sprintf("No match for unary macro '%s %s'", macroName, leftVal.GetTypeString()),
+        Suggestions: currentScope.getMacroSuggestions(macroName, leftVal.GetTypeString()),
+        BaseValue:   BaseValue{Token: operatorToken},
+    })
 }
 
-func (currentScope *Scope) applyBinaryMacro(macroName string, rawLeft Value, rawRight Value, operatorToken *tokenizer.Token) Value {
-    leftVal := interpretExpression(rawLeft, currentScope)
-    leftTypes := gatherTypeStrings(leftVal)
-
-    // Check wildcard matches
-    for _, leftType := range leftTypes {
-        keyWildcard := macroName + " " + leftType + " *"
-        if defAny := currentScope.findDefinition(keyWildcard); defAny != nil {
-            resolvedLeft := resolveValueForType(leftVal, leftType)
-
-            // Construct $$ -> (OP LEFT RIGHT)
-            wholeExpr := &ConsCell{
-                Car: &Symbol{Value: macroName, BaseValue: BaseValue{Token: operatorToken}},
-                Cdr: &ConsCell{
-                    Car: resolvedLeft,
-                    Cdr: &ConsCell{
-                        Car: rawRight, // Raw right for wildcard
-                        Cdr: &Nil{},
-                    },
-                },
-                BaseValue: BaseValue{Token: operatorToken},
-            }
+func (currentScope *Scope) applyBinaryMacro(macroName string, call *macroCall, operatorToken *tokenizer.Token) Value {
+    // How the candidates are ranked is described in dispatch.go
+    if currentScope.interpreter.wildcardNames[macroName] {
+        call.recording = true
+        defer call.writeOutput()
+    }
+    var leftPatterns []typePattern
+    if currentScope.needsLeftValue(macroName, 2) {
+        leftPatterns = currentScope.typePatterns(call.value(0))
+    }
+    if currentScope.interpreter.wildcardNames[macroName] {
+        leftPatterns = append(leftPatterns, typePattern{name: "*", score: wildcardRank})
+    }
+
+    // The argument list of an n-ary call has no value of its own, so it only matches f(*)
+    argumentList := isCallForm(macroName) && isCommaList(call.raw[1]) && currentScope.interpreter.naryNames[macroName]
+    rightPatterns := []typePattern{{name: "*", score: wildcardRank}}
+    if !argumentList && currentScope.needsRightValue(macroName, leftPatterns) {
+        rightPatterns = append(currentScope.typePatterns(call.value(1)), rightPatterns...)
+    }
 
-            return processMacro(defAny.definitionValue, currentScope, resolvedLeft, rawRight, wholeExpr)
+    var candidates []*candidate
+    for _, left := range leftPatterns {
+        for _, right := range rightPatterns {
+            candidates = currentScope.appendCandidates(candidates, macroName+" "+left.name+" "+right.name,
+                []string{left.name, right.name}, []int{left.score, right.score}, false)
         }
     }
+    if !argumentList {
+        candidates = currentScope.appendGenericCandidates(candidates, macroName, call)
+    }
+    if definition, binding := currentScope.resolve(macroName, call, candidates, operatorToken); definition != nil {
+        return currentScope.expand(macroName, definition, binding, operatorToken)
+    }
 
-    rightVal := interpretExpression(rawRight, currentScope)
-    rightTypes := gatherTypeStrings(rightVal)
-
-    // Check exact matches
-    for _, leftType := range leftTypes {
-        for _, rightType := range rightTypes {
-            keyFull := macroName + " " + leftType + " " + rightType
-            if defFull := currentScope.findDefinition(keyFull); defFull != nil {
-                resolvedLeft := resolveValueForType(leftVal, leftType)
-                resolvedRight := resolveValueForType(rightVal, rightType)
-
-                // Construct $$ -> (OP LEFT RIGHT)
-                wholeExpr := &ConsCell{
-                    Car: &Symbol{Value: macroName, BaseValue: BaseValue{Token: operatorToken}},
-                    Cdr: &ConsCell{
-                        Car: resolvedLeft,
-                        Cdr: &ConsCell{
-                            Car: resolvedRight,
-                            Cdr: &Nil{},
-                        },
-                    },
-                    BaseValue: BaseValue{Token: operatorToken},
-                }
+    if definition, binding := currentScope.findNaryDefinition(macroName, call, operatorToken); definition != nil {
+        return currentScope.expand(macroName, definition, binding, operatorToken)
+    }
 
-                return processMacro(defFull.definitionValue, currentScope, resolvedLeft, resolvedRight, wholeExpr)
-            }
-        }
+    // Report the flattened call instead
+    if argumentList {
+        naryCall := newMacroCall(currentScope, append([]Value{call.raw[0]}, getArgsList(call.raw[1])...))
+        naryCall.values[0] = call.value(0)
+        currentScope.raiseNoNaryMatch(macroName, naryCall, operatorToken)
     }
 
     // Error generation with smart suggestions
+    leftVal := call.value(0)
+    rightVal := call.value(1)
     errorMsg := fmt.Sprintf("No match for macro '%s %s %s' (resolved as %s %s %s)",
         leftVal.GetTypeString(),
         macroName,
@@ -346,13 +522,12 @@ func (currentScope *Scope) applyBinaryMacro(macroName string, rawLeft Value, raw
         leftVal.GetTypeString(), macroName, rightVal.GetTypeString(),
     )
 
-    suggestions := currentScope.getMacroSuggestions(macroName, leftVal.GetTypeString(), rightVal.GetTypeString())
-    if len(suggestions) > 0 {
-        errorMsg += fmt.Sprintf("\n\nDid you mean one of these?\n  - %s", strings.Join(suggestions, "\n  - "))
-    }
-
-    RuntimeError(operatorToken, errorMsg)
-    return nil
+    panic(&Error{
+        Code:        CodeNoMatch,
+        Message:     errorMsg,
+        Suggestions: currentScope.getMacroSuggestions(macroName, leftVal.GetTypeString(), rightVal.GetTypeString()),
+        BaseValue:   BaseValue{Token: operatorToken},
+    })
 }
 
 func (currentScope *Scope) lookupSymbol(symbolName string) Value {
@@ -364,20 +539,13 @@ func (currentScope *Scope) lookupSymbol(symbolName string) Value {
     return nil
 }
 
-func (currentScope *Scope) findDefinition(definitionKey string) *Definition {
-    for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
-        if foundDef, ok := searchScope.definitionsMap[definitionKey]; ok {
-            return foundDef
-        }
-    }
-    return nil
-}
-
-func gatherTypeStrings(val Value) []string {
+// gatherTypeStrings returns every type string the value can be matched with, most specific first:
+// its type, its fallback types and the supertypes of both declared with $SUBTYPE.
+func (currentScope *Scope) gatherTypeStrings(val Value) []string {
     if tv, ok := val.(*TypedValue); ok {
-        allTypes := []string{tv.TypeValue.String()}
+        allTypes := currentScope.supertypesOf(tv.TypeValue.String())
         for _, fallback := range tv.TypeFallbacks {
-            allTypes = append(allTypes, fallback.String())
+            allTypes = appendMissing(allTypes, currentScope.supertypesOf(fallback.String())...)
         }
         return allTypes
     }
@@ -386,33 +554,69 @@ func gatherTypeStrings(val Value) []string {
         allTypes := []string{"Union"}
 
         for _, v := range u.Values {
-            allTypes = append(allTypes, gatherTypeStrings(v)...)
+            allTypes = append(allTypes, currentScope.gatherTypeStrings(v)...)
         }
         return allTypes
     }
 
-    return []string{val.GetTypeString()}
+    return currentScope.supertypesOf(val.GetTypeString())
+}
+
+// appendMissing appends the type strings that are not in the list yet.
+func appendMissing(typeStrings []string, more ...string) []string {
+    for _, typeString := range more {
+        found := false
+        for _, existing := range typeStrings {
+            if existing == typeString {
+                found = true
+                break
+            }
+        }
+        if !found {
+            typeStrings = append(typeStrings, typeString)
+        }
+    }
+    return typeStrings
 }
 
-func processMacro(macroValue Value, currentScope *Scope, left Value, right Value, wholeExpression Value) Value {
-    if left == nil && right == nil {
+// processMacro substitutes the arguments for $1..$n, the rest arguments for $... and the whole
+// expression for $$ in the body of the definition and evaluates it.
+func processMacro(definition *Definition, currentScope *Scope, binding *macroBinding) Value {
+    macroValue := definition.definitionValue
+    if len(binding.arguments) == 0 && binding.rest == nil {
         return macroValue
     }
-    macroValue = subSymbol(macroValue, &Symbol{Value: "$1"}, left, true)
-    macroValue = subSymbol(macroValue, &Symbol{Value: "$2"}, right, true)
+    currentScope.interpreter.checkCancelled(binding.whole.GetToken())
+    if definition.hygienic {
+        // Rename before substituting, so the arguments keep their names
+        macroValue = currentScope.interpreter.renameBinders(macroValue)
+    }
+    return interpretExpression(substituteArguments(macroValue, binding), currentScope)
+}
 
-    // NEW: Substitute $$
-    macroValue = subSymbol(macroValue, &Symbol{Value: "$$"}, wholeExpression, true)
+// substituteArguments replaces $1..$n, $..., $$ and the type variables in the body or guard of a definition.
+func substituteArguments(macroValue Value, binding *macroBinding) Value {
+    for i, argument := range binding.arguments {
+        macroValue = subSymbol(macroValue, &Symbol{Value: fmt.Sprintf("$%d", i+1)}, argument, true)
+    }
+    if binding.rest != nil {
+        macroValue = subSymbol(macroValue, &Symbol{Value: restPlaceholder}, binding.rest, true)
+    }
+    for name, boundType := range binding.typeVariables {
+        macroValue = subSymbol(macroValue, &Symbol{Value: name}, boundType, true)
+    }
 
-    return interpretExpression(macroValue, currentScope)
+    // NEW: Substitute $$
+    return subSymbol(macroValue, &Symbol{Value: "$$"}, binding.whole, true)
 }
 
 func generateKey(definitionValue Value) string {
     switch typedValue := definitionValue.(type) {
     case *ConsCell:
+        // f(a, b) is keyed "@call f a b", so the key encodes the arity
         keyString := typedValue.Car.String()
-        for i := 1; i < typedValue.Length(); i++ {
-            keyString += " " + typedValue.Get(i).String()
+        for _, argument := range expressionArguments(typedValue) {
+            keyString += " " + argument.String()
         }
         return keyString
     case *Symbol:
@@ -423,14 +627,11 @@ func generateKey(definitionValue Value) string {
 }
 
 // Helper function to extract the specific value that triggered the type match
-func resolveValueForType(val Value, targetType string) Value {
-    // 1. Handle TypedValue: Check its declared Type and Fallbacks
+func (currentScope *Scope) resolveValueForType(val Value, targetType string) Value {
+    // 1. Handle TypedValue: Check its declared Type, Fallbacks and their supertypes
     if tv, ok := val.(*TypedValue); ok {
-        if tv.TypeValue.String() == targetType {
-            return tv
-        }
-        for _, fallback := range tv.TypeFallbacks {
-            if fallback.String() == targetType {
+        for _, typeString := range currentScope.gatherTypeStrings(tv) {
+            if typeString == targetType {
                 return tv
             }
         }
@@ -445,16 +646,18 @@ func resolveValueForType(val Value, targetType string) Value {
         }
         // Otherwise, find the inner value that matches the target type
         for _, inner := range u.Values {
-            if found := resolveValueForType(inner, targetType); found != nil {
+            if found := currentScope.resolveValueForType(inner, targetType); found != nil {
                 return found
             }
         }
         return nil
     }
 
-    // 3. Handle Standard Types (Integer, String, etc.)
-    if val.GetTypeString() == targetType {
-        return val
+    // 3. Handle Standard Types (Integer, String, etc.) and their supertypes
+    for _, typeString := range currentScope.supertypesOf(val.GetTypeString()) {
+        if typeString == targetType {
+            return val
+        }
     }
 
     return nil
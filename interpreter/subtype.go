@@ -0,0 +1,208 @@
+package interpreter
+
+// $SUBTYPE(sub, super) declares that every value of type sub also has type super:
+//
+//	$SUBTYPE(VALUE_I32, VALUE_INT)
+//	$SUBTYPE(VALUE_INT, VALUE)
+//	VALUE + VALUE ::= ... // also matches VALUE_I32 + VALUE_I32
+//
+// The declaration is visible in the scope it is made in and in nested scopes, like a definition.
+// gatherTypeStrings lists the supertypes of a type after the type itself, in the C3 linearization of
+// the hierarchy (as used for method resolution in Python): every type comes before its supertypes, and
+// the supertypes of one type keep the order in which they were declared. Dispatch therefore prefers a
+// rule for a closer supertype, see dispatch.go.
+
+// directSupertypes returns the supertypes declared for the type visible from this scope, in
+// declaration order. Declarations of enclosing scopes come after those of inner scopes.
+func (currentScope *Scope) directSupertypes(typeName string) []string {
+	var supertypes []string
+	seen := make(map[string]bool)
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		for _, supertype := range searchScope.supertypes[typeName] {
+			if !seen[supertype] {
+				seen[supertype] = true
+				supertypes = append(supertypes, supertype)
+			}
+		}
+	}
+	return supertypes
+}
+
+// linearizationKey identifies a linearization: the type, and the innermost scope declaring
+// supertypes that is visible where it was computed. Scopes in between see the same hierarchy.
+type linearizationKey struct {
+	scope    *Scope
+	typeName string
+}
+
+type linearization struct {
+	types []string
+	ok    bool
+}
+
+// hierarchyScope returns the innermost scope visible from this one that declares supertypes.
+func (currentScope *Scope) hierarchyScope() *Scope {
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		if searchScope.supertypes != nil {
+			return searchScope
+		}
+	}
+	return nil
+}
+
+// linearize returns the type followed by all its supertypes in C3 order.
+// It reports false if the declared hierarchy has no consistent order.
+// Every dispatch on a type asks for it, so the result is cached until the next $SUBTYPE.
+func (currentScope *Scope) linearize(typeName string) ([]string, bool) {
+	interpreter := currentScope.interpreter
+	key := linearizationKey{scope: currentScope.hierarchyScope(), typeName: typeName}
+	if cached, found := interpreter.linearizations[key]; found {
+		return cached.types, cached.ok
+	}
+	types, ok := currentScope.linearizeVisiting(typeName, make(map[string]bool))
+	types = types[:len(types):len(types)] // Callers that append must not write into the cached array
+	if interpreter.linearizations == nil {
+		interpreter.linearizations = make(map[linearizationKey]linearization)
+	}
+	interpreter.linearizations[key] = linearization{types: types, ok: ok}
+	return types, ok
+}
+
+func (currentScope *Scope) linearizeVisiting(typeName string, visiting map[string]bool) ([]string, bool) {
+	direct := currentScope.directSupertypes(typeName)
+	if len(direct) == 0 {
+		return []string{typeName}, true
+	}
+	if visiting[typeName] {
+		return nil, false // A cycle through declarations of different scopes
+	}
+	visiting[typeName] = true
+	defer delete(visiting, typeName)
+
+	var sequences [][]string
+	for _, supertype := range direct {
+		linearization, ok := currentScope.linearizeVisiting(supertype, visiting)
+		if !ok {
+			return nil, false
+		}
+		sequences = append(sequences, linearization)
+	}
+	sequences = append(sequences, direct)
+
+	result := []string{typeName}
+	for {
+		// Drop exhausted sequences
+		remaining := sequences[:0]
+		for _, sequence := range sequences {
+			if len(sequence) > 0 {
+				remaining = append(remaining, sequence)
+			}
+		}
+		sequences = remaining
+		if len(sequences) == 0 {
+			return result, true
+		}
+
+		// The next type is the first head that is in no tail
+		next := ""
+		for _, sequence := range sequences {
+			if !inAnyTail(sequence[0], sequences) {
+				next = sequence[0]
+				break
+			}
+		}
+		if next == "" {
+			return nil, false
+		}
+		result = append(result, next)
+		for i, sequence := range sequences {
+			if sequence[0] == next {
+				sequences[i] = sequence[1:]
+			}
+		}
+	}
+}
+
+func inAnyTail(typeName string, sequences [][]string) bool {
+	for _, sequence := range sequences {
+		for _, other := range sequence[1:] {
+			if other == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSubtype reports whether sub is super or one of its declared subtypes.
+func (currentScope *Scope) isSubtype(sub string, super string) bool {
+	for _, typeName := range currentScope.supertypesOf(sub) {
+		if typeName == super {
+			return true
+		}
+	}
+	return false
+}
+
+// declareSubtype adds super as a direct supertype of sub in this scope.
+func (currentScope *Scope) declareSubtype(sub string, super string, at Value) {
+	if super == sub || currentScope.isSubtype(super, sub) {
+		raiseAt(CodeRuntime, at, "Cannot declare %s a subtype of %s: %s is already a subtype of %s", sub, super, super, sub)
+	}
+	if currentScope.supertypes == nil {
+		currentScope.supertypes = make(map[string][]string)
+	}
+	previous := currentScope.supertypes[sub]
+	for _, declared := range previous {
+		if declared == super {
+			return
+		}
+	}
+	currentScope.supertypes[sub] = append(previous, super)
+	currentScope.interpreter.linearizations = nil
+	if inconsistent := currentScope.findInconsistentType(); inconsistent != "" {
+		currentScope.supertypes[sub] = previous
+		currentScope.interpreter.linearizations = nil
+		raiseAt(CodeRuntime, at, "Cannot declare %s a subtype of %s: the supertypes of %s would have no consistent order", sub, super, inconsistent)
+	}
+	currentScope.interpreter.subtyping = true
+}
+
+// findInconsistentType returns a type visible from this scope whose supertypes cannot be linearized,
+// or "" if there is none.
+func (currentScope *Scope) findInconsistentType() string {
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		for typeName := range searchScope.supertypes {
+			if _, ok := currentScope.linearize(typeName); !ok {
+				return typeName
+			}
+		}
+	}
+	return ""
+}
+
+// supertypesOf returns the type followed by its supertypes, see linearize. An inconsistent
+// hierarchy, which can only arise from declarations in different scopes, is walked depth-first.
+func (currentScope *Scope) supertypesOf(typeName string) []string {
+	if !currentScope.interpreter.subtyping {
+		return []string{typeName}
+	}
+	if linearization, ok := currentScope.linearize(typeName); ok {
+		return linearization
+	}
+	var result []string
+	seen := make(map[string]bool)
+	var walk func(string)
+	walk = func(current string) {
+		if seen[current] {
+			return
+		}
+		seen[current] = true
+		result = append(result, current)
+		for _, supertype := range currentScope.directSupertypes(current) {
+			walk(supertype)
+		}
+	}
+	walk(typeName)
+	return result
+}
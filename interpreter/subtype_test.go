@@ -0,0 +1,25 @@
+package interpreter
+
+import "testing"
+
+func TestSubtypeDeclarationUpdatesCachedHierarchy(t *testing.T) {
+	expectOutput(t, `
+$SUBTYPE(B, VALUE)
+x ::= $TYPEDEF(1, A)
+$PRINTLN($TYPEOF(x, VALUE))
+$SUBTYPE(A, VALUE)
+$PRINTLN($TYPEOF(x, VALUE))
+`, "nil", "1")
+}
+
+func TestSubtypeDeclaredInBlockStaysInBlock(t *testing.T) {
+	expectOutput(t, `
+$SUBTYPE(B, VALUE)
+x ::= $TYPEDEF(1, A)
+{
+  $SUBTYPE(A, VALUE)
+  $PRINTLN($TYPEOF(x, VALUE))
+}
+$PRINTLN($TYPEOF(x, VALUE))
+`, "1", "nil")
+}
@@ -0,0 +1,81 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+// SetTrace enables logging of every macro dispatch to the writer. A nil writer disables it.
+// $TRACE(on) and $TRACE(off) toggle the trace from within a program, writing to the writer
+// set here or with SetTraceOutput.
+func (interpreter *Interpreter) SetTrace(traceOutput io.Writer) {
+	interpreter.tracing = traceOutput != nil
+	if traceOutput != nil {
+		interpreter.traceOutput = traceOutput
+	}
+}
+
+// SetTraceOutput sets the writer that $TRACE(on) logs to, without enabling the trace.
+// The trace is discarded until a writer is set. A nil writer discards it again.
+func (interpreter *Interpreter) SetTraceOutput(traceOutput io.Writer) {
+	if traceOutput == nil {
+		traceOutput = io.Discard
+	}
+	interpreter.traceOutput = traceOutput
+}
+
+// enterExpansion is called when a macro call has been dispatched to a definition.
+// It logs the dispatch if tracing is enabled. The returned function must be deferred: it ends the
+// expansion and, if an error unwinds through it, records the expansion in the error's backtrace.
+func (currentScope *Scope) enterExpansion(macroName string, argTypes []string, definition *Definition, callToken *tokenizer.Token) func() {
+	interpreter := currentScope.interpreter
+	ruleParts := strings.Split(definition.definitionName, " ")
+
+	if interpreter.tracing {
+		how := "exact"
+		for i, ruleType := range ruleParts[1:] {
+			if ruleType == "*" || ruleType == restPattern {
+				how = "wildcard"
+				break
+			}
+			if i < len(argTypes) && ruleType != argTypes[i] {
+				how = "fallback"
+			}
+		}
+
+		fmt.Fprintf(interpreter.traceOutput, "%s%s => %s [%s] at %s (rule at %s)\n",
+			strings.Repeat("  ", interpreter.traceDepth),
+			formatSignature(append([]string{macroName}, argTypes...)),
+			formatSignature(ruleParts),
+			how,
+			formatLocation(callToken),
+			formatLocation(definition.definitionToken),
+		)
+	}
+
+	interpreter.traceDepth++
+	return func() {
+		interpreter.traceDepth--
+		if recovered := recover(); recovered != nil {
+			if raised, ok := recovered.(*Error); ok {
+				raised.Backtrace = append(raised.Backtrace, ExpansionFrame{
+					Signature:       formatSignature(ruleParts),
+					CallToken:       callToken,
+					DefinitionToken: definition.definitionToken,
+				})
+			}
+			panic(recovered)
+		}
+	}
+}
+
+// formatLocation renders the position of a token as source:line:column.
+func formatLocation(token *tokenizer.Token) string {
+	if token == nil {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s:%d:%d", token.Source, token.Line, token.Column)
+}
@@ -0,0 +1,50 @@
+package interpreter
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+const traceSource = `
+int ! int ::= $PRINTLN("called")
+$TRACE(on)
+1 ! 2
+`
+
+func TestTraceIsDiscardedByDefault(t *testing.T) {
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(original *os.File) { os.Stderr = original }(os.Stderr)
+	os.Stderr = stderr
+	expectOutput(t, traceSource, "called")
+	if trace, _ := os.ReadFile(stderr.Name()); len(trace) > 0 {
+		t.Errorf("expected no trace on stderr, got %q", trace)
+	}
+}
+
+func TestTraceIsWrittenToTraceOutput(t *testing.T) {
+	var trace strings.Builder
+	interp := NewInterpreter(context.Background(), nil, nil)
+	interp.SetTraceOutput(&trace)
+	module, _ := interp.Parse(traceSource, "test.gsm")
+	if err := interp.Run(module); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(trace.String(), "=>") {
+		t.Errorf("expected the trace in the trace output, got %q", trace.String())
+	}
+}
+
+func TestEmptyCallErrorsPointAtTheCall(t *testing.T) {
+	for _, code := range []string{"$TRACE()", "$LOAD_ONCE()"} {
+		_, err := run(t, "x ::= 1\n"+code+"\n")
+		raised, ok := err.(*Error)
+		if !ok || raised.Token == nil || raised.Token.Line != 2 || raised.Token.Column != 1 {
+			t.Errorf("%s: expected an error at 2:1, got %v", code, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package interpreter
+
+import (
+	"strings"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+// Types can take type arguments, written without whitespace: Pointer<int>, Map<string,Vector<int>>.
+// Such a type is a TypeTerm, so $TYPEDEF(addr, Pointer<VALUE_I32>) gives addr the type string
+// "Pointer<VALUE_I32>".
+//
+// In a macro pattern, a type argument that is a single upper case letter is a type variable.
+// It matches any type argument and is bound in the body (and guard):
+//
+//	Pointer<T> + int ::= $TYPEDEF($ADD($UNTYPE($1), $2), Pointer<T>)
+//	if(VALUE<T>) ::= ...    // matches VALUE<I8>, VALUE<I32>, ...
+//	if(VALUE<I8>) ::= ...   // I8 is a type name, so this only matches VALUE<I8> and wins over VALUE<T>
+//
+// A type variable used twice must match the same type both times. A generic pattern ranks after
+// the exact type it matches, but before the next fallback type (see dispatch.go). Between generic
+// patterns, the one with more fixed structure wins: Pair<T,T> and Pair<int,U> before Pair<A,B>.
+
+// isTypeVariable reports whether a type argument in a pattern is a type variable such as T or U.
+// Longer names such as I32 are types, so they can be used as type arguments in patterns.
+func isTypeVariable(name string) bool {
+	return len(name) == 1 && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// isGenericPattern reports whether a pattern of a definition key contains a type variable.
+func isGenericPattern(pattern string) bool {
+	if !strings.ContainsRune(pattern, '<') {
+		return false
+	}
+	term, ok := parseTypeTerm(pattern, nil).(*TypeTerm)
+	return ok && hasTypeVariable(term)
+}
+
+func hasTypeVariable(term *TypeTerm) bool {
+	for _, argument := range term.Arguments {
+		switch argument := argument.(type) {
+		case *Symbol:
+			if isTypeVariable(argument.Value) {
+				return true
+			}
+		case *TypeTerm:
+			if hasTypeVariable(argument) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeSpecificity counts the constructors, concrete types and repeated type variables of a pattern.
+// A pattern that only matches instances of another pattern has a higher count.
+func typeSpecificity(pattern Value, seen map[string]bool) int {
+	switch pattern := pattern.(type) {
+	case *Symbol:
+		if !isTypeVariable(pattern.Value) || seen[pattern.Value] {
+			return 1
+		}
+		seen[pattern.Value] = true
+		return 0
+	case *TypeTerm:
+		count := 1
+		for _, argument := range pattern.Arguments {
+			count += typeSpecificity(argument, seen)
+		}
+		return count
+	}
+	return 0
+}
+
+// parseTypeTerm parses a type such as Map<K,Vector<V>>. Text that is not a well-formed
+// parameterized type is returned as a Symbol.
+func parseTypeTerm(text string, token *tokenizer.Token) Value {
+	value, rest, ok := parseTypeTermPrefix(text, token)
+	if !ok || rest != "" {
+		return &Symbol{Value: text, BaseValue: BaseValue{Token: token}}
+	}
+	return value
+}
+
+func parseTypeTermPrefix(text string, token *tokenizer.Token) (Value, string, bool) {
+	end := strings.IndexAny(text, "<,>")
+	if end < 0 {
+		end = len(text)
+	}
+	name := text[:end]
+	if name == "" {
+		return nil, text, false
+	}
+	rest := text[end:]
+	if !strings.HasPrefix(rest, "<") {
+		return &Symbol{Value: name, BaseValue: BaseValue{Token: token}}, rest, true
+	}
+
+	term := &TypeTerm{Constructor: name, BaseValue: BaseValue{Token: token}}
+	rest = rest[1:]
+	for {
+		argument, remaining, ok := parseTypeTermPrefix(rest, token)
+		if !ok {
+			return nil, text, false
+		}
+		term.Arguments = append(term.Arguments, argument)
+		switch {
+		case strings.HasPrefix(remaining, ","):
+			rest = remaining[1:]
+		case strings.HasPrefix(remaining, ">"):
+			return term, remaining[1:], true
+		default:
+			return nil, text, false
+		}
+	}
+}
+
+// unifyType matches a pattern against a type string, extending the bindings of its type variables.
+// The bindings are only changed if the type matches.
+func unifyType(pattern string, typeString string, bindings map[string]Value) bool {
+	trial := make(map[string]Value, len(bindings))
+	for name, bound := range bindings {
+		trial[name] = bound
+	}
+	if !unifyTerms(parseTypeTerm(pattern, nil), parseTypeTerm(typeString, nil), trial, true) {
+		return false
+	}
+	for name, bound := range trial {
+		bindings[name] = bound
+	}
+	return true
+}
+
+func unifyTerms(pattern Value, actual Value, bindings map[string]Value, topLevel bool) bool {
+	switch pattern := pattern.(type) {
+	case *Symbol:
+		if !topLevel && isTypeVariable(pattern.Value) {
+			if bound, found := bindings[pattern.Value]; found {
+				return bound.String() == actual.String()
+			}
+			bindings[pattern.Value] = actual
+			return true
+		}
+		return pattern.String() == actual.String()
+	case *TypeTerm:
+		actualTerm, ok := actual.(*TypeTerm)
+		if !ok || actualTerm.Constructor != pattern.Constructor || len(actualTerm.Arguments) != len(pattern.Arguments) {
+			return false
+		}
+		for i, argument := range pattern.Arguments {
+			if !unifyTerms(argument, actualTerm.Arguments[i], bindings, false) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
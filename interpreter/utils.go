@@ -25,7 +25,12 @@ func syntaxNode2Value(expression *parser.SyntaxNode) Value {
 			return &Integer{Value: value, BaseValue: BaseValue{Token: tok}}
 		case tokentype.String:
 			return &String{Value: expression.Value.Value, BaseValue: BaseValue{Token: tok}}
-		case tokentype.Operator, tokentype.Identifier, tokentype.LParent, tokentype.LCurlyParent:
+		case tokentype.Identifier:
+			if strings.ContainsRune(expression.Value.Alias, '<') {
+				return parseTypeTerm(expression.Value.Alias, tok)
+			}
+			return &Symbol{Value: expression.Value.Alias, BaseValue: BaseValue{Token: tok}}
+		case tokentype.Operator, tokentype.LParent, tokentype.LCurlyParent, tokentype.LSquaredParent:
 			return &Symbol{Value: expression.Value.Alias, BaseValue: BaseValue{Token: tok}}
 		case tokentype.Module:
 			return &Symbol{Value: expression.Value.Alias, BaseValue: BaseValue{Token: tok}}
@@ -47,11 +52,13 @@ func syntaxNode2Value(expression *parser.SyntaxNode) Value {
 	}
     
     // The main ConsCell gets the token from the Operator
-	return &ConsCell{
+	expressionValue := &ConsCell{
 		Car: syntaxNode2Value(expression.Operator),
 		Cdr: arguments,
         BaseValue: BaseValue{Token: expression.Operator.Value},
 	}
+	expressionValue.First, expressionValue.Last = sourceExtent(expressionValue, expression.Closing)
+	return expressionValue
 }
 
 func subSymbol(value Value, sym *Symbol, sub Value, limited bool) Value {
@@ -64,12 +71,21 @@ func subSymbol(value Value, sym *Symbol, sub Value, limited bool) Value {
             Car: subSymbol(v.Car, sym, sub, limited),
             Cdr: subSymbol(v.Cdr, sym, sub, limited),
             BaseValue: v.BaseValue, 
+            First: v.First,
+            Last: v.Last,
         }
     case *Symbol:
         if v.Value == sym.Value {
             return sub
         }
         break
+    case *TypeTerm:
+        // Type variables in type arguments, e.g. T in Pointer<T>
+        arguments := make([]Value, len(v.Arguments))
+        for i, argument := range v.Arguments {
+            arguments[i] = subSymbol(argument, sym, sub, limited)
+        }
+        return &TypeTerm{Constructor: v.Constructor, Arguments: arguments, BaseValue: v.BaseValue}
     }
 
     return value
@@ -88,7 +104,8 @@ func isMacroVariableAssignment(expr *ConsCell) bool {
 }
 
 func flattenBySeparator(value Value, separator string) []Value {
-    if consCell, ok := value.(*ConsCell); ok {
+    // A list bound to a wildcard is split as written, see wildcard.go
+    if consCell, ok := unwrapCode(value).(*ConsCell); ok {
         first := consCell.Get(0)
         if first.GetTypeString() == "symbol" && first.String() == separator {
             return append(flattenBySeparator(consCell.Get(1), separator), consCell.Get(2))
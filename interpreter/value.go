@@ -1,7 +1,9 @@
 package interpreter
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 
 	"gismolang.org/compiler/tokenizer"
 )
@@ -64,6 +66,21 @@ func (typeValue TypedValue) String() string {
 }
 func (typedValue *TypedValue) GetTypeString() string { return typedValue.TypeValue.String() }
 
+// TypeTerm is a parameterized type such as Pointer<int>: a constructor applied to type arguments.
+type TypeTerm struct {
+	BaseValue
+	Constructor string
+	Arguments   []Value // Symbols and TypeTerms
+}
+func (term TypeTerm) String() string {
+	arguments := make([]string, len(term.Arguments))
+	for i, argument := range term.Arguments {
+		arguments[i] = argument.String()
+	}
+	return term.Constructor + "<" + strings.Join(arguments, ",") + ">"
+}
+func (term *TypeTerm) GetTypeString() string { return "type" }
+
 type BuiltinFunction struct {
 	BaseValue
 	callback   func(value Value, scope *Scope) Value
@@ -76,8 +93,10 @@ func (builtinFunction BuiltinFunction) String() string {
 
 type ConsCell struct {
 	BaseValue
-	Car Value
-	Cdr Value
+	Car   Value
+	Cdr   Value
+	First *tokenizer.Token // First source token of the parsed expression, nil if built at runtime
+	Last  *tokenizer.Token // Last source token, the closing bracket of a block, list or call
 }
 func (consCell *ConsCell) String() string {
 	if consCell == nil { return "nil" }
@@ -138,4 +157,28 @@ func (u *Union) String() string {
 	for _, val := range u.Values { str += " " + val.String() }
 	str += ">"
 	return str
-}
\ No newline at end of file
+}
+// Error is raised by RuntimeError and $RAISE and can be caught with $TRY.
+type Error struct {
+	BaseValue
+	End         *tokenizer.Token // Last token of the code the error refers to, nil for a single token
+	Code        string           // Kind of the error, one of the Code constants
+	Message     string
+	Suggestions []string         // Definitions the user may have meant
+	Backtrace   []ExpansionFrame // Macro expansions in progress when raised, innermost first
+}
+
+// ExpansionFrame is a macro expansion that was in progress when an error was raised.
+type ExpansionFrame struct {
+	Signature       string           // Definition that was expanded, e.g. "VALUE_I32 + VALUE_I32"
+	CallToken       *tokenizer.Token // Where the macro was called
+	DefinitionToken *tokenizer.Token // Where the definition was made
+}
+func (e *Error) GetTypeString() string { return "Error" }
+func (e *Error) String() string        { return e.Error() }
+func (e *Error) Error() string {
+	if len(e.Suggestions) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s\n\nDid you mean one of these?\n  - %s", e.Message, strings.Join(e.Suggestions, "\n  - "))
+}
@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+// CodeWarning is the code of warnings raised with $WARN without an explicit code.
+const CodeWarning = "warning"
+
+// Warning is a problem reported with $WARN. Unlike an Error it does not stop the compilation.
+type Warning struct {
+	Token   *tokenizer.Token // First token of the code the warning refers to
+	End     *tokenizer.Token // Last token of the code the warning refers to
+	Code    string
+	Message string
+}
+
+// SetWarningEnabled enables or disables the warnings with the given code (-W<code>, -Wno-<code>).
+// All warnings are enabled by default.
+func (interpreter *Interpreter) SetWarningEnabled(code string, enabled bool) {
+	interpreter.disabledWarnings[code] = !enabled
+}
+
+// SetWarningsAsErrors makes the compilation fail if any warning was reported (-Werror).
+func (interpreter *Interpreter) SetWarningsAsErrors(enabled bool) {
+	interpreter.warningsAsErrors = enabled
+}
+
+// WarningsAsErrors reports whether warnings make the compilation fail.
+func (interpreter *Interpreter) WarningsAsErrors() bool {
+	return interpreter.warningsAsErrors
+}
+
+// Warnings returns all warnings reported so far, in order.
+func (interpreter *Interpreter) Warnings() []Warning {
+	return interpreter.warnings
+}
+
+// warn records a warning with the given code spanning the value, unless the code is disabled.
+func (interpreter *Interpreter) warn(code string, value Value, format string, a ...interface{}) {
+	if interpreter.disabledWarnings[code] {
+		return
+	}
+	start, end := valueSpan(value)
+	interpreter.warnings = append(interpreter.warnings, Warning{
+		Token:   start,
+		End:     end,
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// RenderWarnings writes every warning with source context.
+// With -Werror the warnings are shown as errors.
+func (interpreter *Interpreter) RenderWarnings(w io.Writer) {
+	for _, warning := range interpreter.warnings {
+		if interpreter.warningsAsErrors {
+			fmt.Fprintf(w, "Error: %s [-Werror=%s]\n", warning.Message, warning.Code)
+		} else {
+			fmt.Fprintf(w, "Warning: %s [-W%s]\n", warning.Message, warning.Code)
+		}
+		if warning.Token != nil {
+			interpreter.renderErrorContext(w, warning.Token, warning.End)
+		}
+	}
+}
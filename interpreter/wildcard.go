@@ -0,0 +1,189 @@
+package interpreter
+
+import (
+	"strings"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+// A * in a pattern matches any argument and passes it to the body as raw, unevaluated code:
+//
+//	op *        // unary wildcard
+//	T op *      // right wildcard
+//	* op T      // left wildcard, e.g. (*) <- int ::= { $EXPORT($1, $2) } assigns to an unbound name
+//	* op *      // both sides raw
+//
+// A wildcard ranks below every typed pattern, including one matched through a fallback type (see
+// dispatch.go). An argument is only evaluated if a visible definition matches it by type: the left
+// side if the macro has a definition with a typed first argument, the right side if a definition
+// `L op R` with a typed R exists for a type L of the left side.
+//
+// An argument evaluated to rank the typed definitions is not run a second time when a wildcard wins:
+// the wildcard receives the raw code as an evaluatedCode, whose first evaluation returns the result
+// already computed. The output the argument wrote meanwhile is held back until then, so the side
+// effects of `1 + $PRINTLN("x")` happen once and where the body evaluates its argument, as if the
+// argument had not been evaluated during dispatch. Builtins that take code rather than values see
+// through the wrapper: $QUOTE returns the raw code, and argument lists are flattened as written.
+
+// evaluatedCode is raw code bound to a wildcard that was already evaluated once during dispatch.
+// It reads as the code it wraps; evaluating it the first time returns the stored result.
+type evaluatedCode struct {
+	BaseValue
+	Code   Value
+	Result Value
+	Output *deferredOutput // Written by the evaluation, replayed on first use
+	used   bool
+}
+
+func (code *evaluatedCode) GetTypeString() string { return code.Code.GetTypeString() }
+func (code *evaluatedCode) String() string        { return code.Code.String() }
+
+// evaluate returns the stored result the first time and evaluates the code again afterwards,
+// so a body that runs its argument repeatedly still sees every evaluation.
+func (code *evaluatedCode) evaluate(scope *Scope) Value {
+	if !code.used {
+		code.used = true
+		code.Output.replay(scope.interpreter)
+		return code.Result
+	}
+	return interpretExpression(code.Code, scope)
+}
+
+// unwrapCode returns the raw code of an argument bound to a wildcard.
+func unwrapCode(value Value) Value {
+	if code, ok := value.(*evaluatedCode); ok {
+		return code.Code
+	}
+	return value
+}
+
+// unwrapAll returns the code with every argument bound to a wildcard replaced by its raw code.
+func unwrapAll(value Value) Value {
+	switch v := value.(type) {
+	case *evaluatedCode:
+		return v.Code
+	case *ConsCell:
+		car, cdr := unwrapAll(v.Car), unwrapAll(v.Cdr)
+		if car == v.Car && cdr == v.Cdr {
+			return v
+		}
+		return &ConsCell{Car: car, Cdr: cdr, BaseValue: v.BaseValue, First: v.First, Last: v.Last}
+	}
+	return value
+}
+
+// wildcardArgument returns the code bound to a wildcard at the position of the call.
+// Literals and symbols evaluate without side effects and are passed as they are.
+func (call *macroCall) wildcardArgument(position int) Value {
+	raw := call.raw[position]
+	if _, isCode := raw.(*ConsCell); !isCode || call.values[position] == nil {
+		return raw
+	}
+	return &evaluatedCode{Code: raw, Result: call.values[position], Output: call.outputs[position], BaseValue: BaseValue{Token: raw.GetToken()}}
+}
+
+// deferredOutput is what an argument wrote to the output and stdout while it was evaluated during
+// dispatch of a macro with wildcard definitions.
+type deferredOutput struct {
+	chunks []outputChunk
+}
+
+type outputChunk struct {
+	stdout bool // Written to stdout rather than the output
+	data   []byte
+}
+
+// replay writes the recorded output to the current writers of the interpreter, once.
+func (output *deferredOutput) replay(interpreter *Interpreter) {
+	if output == nil {
+		return
+	}
+	chunks := output.chunks
+	output.chunks = nil
+	for _, chunk := range chunks {
+		if chunk.stdout {
+			interpreter.stdout.Write(chunk.data)
+		} else {
+			interpreter.output.Write(chunk.data)
+		}
+	}
+}
+
+// outputRecorder appends what is written to it to a deferredOutput.
+type outputRecorder struct {
+	recording *deferredOutput
+	stdout    bool
+}
+
+func (recorder outputRecorder) Write(data []byte) (int, error) {
+	recorder.recording.chunks = append(recorder.recording.chunks, outputChunk{stdout: recorder.stdout, data: append([]byte(nil), data...)})
+	return len(data), nil
+}
+
+// recordOutput evaluates the code with the output and stdout of the interpreter recorded rather
+// than written. If the evaluation raises, the recorded output is written before the error travels on.
+func (interpreter *Interpreter) recordOutput(code Value, scope *Scope) (result Value, recording *deferredOutput) {
+	recording = &deferredOutput{}
+	output, stdout := interpreter.output, interpreter.stdout
+	interpreter.output = outputRecorder{recording: recording}
+	interpreter.stdout = outputRecorder{recording: recording, stdout: true}
+	defer func() {
+		interpreter.output, interpreter.stdout = output, stdout
+		if recovered := recover(); recovered != nil {
+			recording.replay(interpreter)
+			panic(recovered)
+		}
+	}()
+	return interpretExpression(code, scope), recording
+}
+
+// wholeExpression constructs the value of $$ -> (OP ARG1 ... ARGN).
+func wholeExpression(macroName string, operatorToken *tokenizer.Token, arguments ...Value) Value {
+	var wholeExpr Value = &Nil{}
+	for i := len(arguments) - 1; i >= 0; i-- {
+		wholeExpr = &ConsCell{Car: arguments[i], Cdr: wholeExpr}
+	}
+	return &ConsCell{
+		Car:       &Symbol{Value: macroName, BaseValue: BaseValue{Token: operatorToken}},
+		Cdr:       wholeExpr,
+		BaseValue: BaseValue{Token: operatorToken},
+	}
+}
+
+// anyDefinition reports whether the argument patterns of a definition of the macro visible from
+// this scope satisfy the condition.
+func (currentScope *Scope) anyDefinition(macroName string, condition func(patterns []string) bool) bool {
+	searchPrefix := macroName + " "
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		for key := range searchScope.definitionsMap {
+			if strings.HasPrefix(key, searchPrefix) && condition(strings.Split(key, " ")[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// needsLeftValue reports whether the first argument of a call with the given number of arguments
+// must be evaluated to dispatch it, i.e. whether it is not matched only by wildcards.
+func (currentScope *Scope) needsLeftValue(macroName string, arity int) bool {
+	if !currentScope.interpreter.wildcardNames[macroName] {
+		return true
+	}
+	return currentScope.anyDefinition(macroName, func(patterns []string) bool {
+		return len(patterns) == arity && patterns[0] != "*"
+	})
+}
+
+// needsRightValue reports whether a binary definition visible from this scope matches the right
+// side by type for one of the left patterns.
+func (currentScope *Scope) needsRightValue(macroName string, leftPatterns []typePattern) bool {
+	for searchScope := currentScope; searchScope != nil; searchScope = searchScope.parentScope {
+		for _, left := range leftPatterns {
+			if searchScope.typedRightKeys[macroName+" "+left.name] {
+				return true
+			}
+		}
+	}
+	return false
+}
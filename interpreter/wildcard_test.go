@@ -0,0 +1,76 @@
+package interpreter
+
+import "testing"
+
+func TestLeftWildcardEvaluatesOnce(t *testing.T) {
+	expectOutput(t, `
+(*) <- int ::= {
+  $PRINTLN("wild")
+  $1
+}
+int <- int ::= $PRINTLN("typed")
+$PRINTLN("side") <- 1
+`, "wild", "side")
+}
+
+func TestLeftWildcardKeepsUnboundName(t *testing.T) {
+	expectOutput(t, `
+(*) <- int ::= {
+  $EXPORT($1, $2)
+}
+int <- int ::= $PRINTLN("typed")
+x <- 5
+$PRINTLN(x)
+x <- 6
+`, "5", "typed")
+}
+
+func TestWildcardOnlyArgumentIsNotEvaluated(t *testing.T) {
+	expectOutput(t, `
+(*) <- (*) ::= $PRINTLN("raw")
+$PRINTLN("side") <- $PRINTLN("side")
+`, "raw")
+}
+
+func TestWildcardBodyRepeatsEvaluation(t *testing.T) {
+	expectOutput(t, `
+(*) <- int ::= {
+  $1
+  $1
+}
+int <- int ::= $PRINTLN("typed")
+$PRINTLN("side") <- 1
+`, "side", "side")
+}
+
+func TestTypedArgumentOutputPrecedesBody(t *testing.T) {
+	expectOutput(t, `
+(*) <- int ::= $PRINTLN("wild")
+int <- int ::= $PRINTLN("typed")
+{
+  $PRINT("side ")
+  1
+} <- 1
+`, "side typed")
+}
+
+func TestUnusedWildcardArgumentOutputIsKept(t *testing.T) {
+	expectOutput(t, `
+(*) <- int ::= $PRINTLN("wild")
+string <- int ::= $PRINTLN("typed")
+$PRINTLN("side") <- 1
+`, "wild", "side")
+}
+
+func TestBuiltinsSeeRawWildcardCode(t *testing.T) {
+	expectOutput(t, `
+int + int ::= $ADD($1, $2)
+(*) <- int ::= {
+  $PRINTLN($QUOTE($1))
+  $PRINTLN($FLATTEN($QUOTE($1 + $2), "+"))
+  $PRINTLN($TYPEOF($1, int))
+}
+string <- int ::= $PRINTLN("typed")
+(2 + 3) <- 4
+`, "(+ 2 3)", "[2, 3, 4]", "1")
+}
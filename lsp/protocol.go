@@ -0,0 +1,218 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// message is an incoming JSON-RPC request or notification. Notifications have no ID.
+type message struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// connection reads and writes LSP base protocol messages (a Content-Length header followed by JSON).
+type connection struct {
+	reader *textproto.Reader
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func newConnection(in io.Reader, out io.Writer) *connection {
+	return &connection{
+		reader: textproto.NewReader(bufio.NewReader(in)),
+		writer: out,
+	}
+}
+
+// malformedMessageError is returned by read for a message whose body is not valid JSON.
+// The message was framed correctly, so the next one can still be read.
+type malformedMessageError struct {
+	err error
+}
+
+func (e *malformedMessageError) Error() string { return "malformed message: " + e.err.Error() }
+func (e *malformedMessageError) Unwrap() error { return e.err }
+
+// read returns the next message. It returns io.EOF once the input is closed.
+func (conn *connection) read() (*message, error) {
+	header, err := conn.reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn.reader.R, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, &malformedMessageError{err: err}
+	}
+	return &msg, nil
+}
+
+func (conn *connection) write(value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	if _, err := fmt.Fprintf(conn.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = conn.writer.Write(body)
+	return err
+}
+
+func (conn *connection) reply(id *json.RawMessage, result interface{}) error {
+	return conn.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (conn *connection) replyError(id *json.RawMessage, code int, text string) error {
+	return conn.write(response{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: text}})
+}
+
+func (conn *connection) notify(method string, params interface{}) error {
+	return conn.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Protocol types (only the fields used by the server)
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string    `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"`
+	Code     string    `json:"code,omitempty"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+// Diagnostic severities
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *textRange    `json:"range,omitempty"`
+}
+
+type completionItem struct {
+	Label         string         `json:"label"`
+	Kind          int            `json:"kind,omitempty"`
+	Detail        string         `json:"detail,omitempty"`
+	Documentation *markupContent `json:"documentation,omitempty"`
+}
+
+// Completion item kinds
+const (
+	completionKindFunction = 3
+	completionKindOperator = 24
+)
+
+// uriToPath converts a file:// URI to a file system path.
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+// pathToURI converts a file system path to a file:// URI.
+func pathToURI(path string) string {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
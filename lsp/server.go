@@ -0,0 +1,514 @@
+// Package lsp implements a Language Server Protocol server for Gismo (.gsm) files.
+//
+// Every time a document changes it is parsed and run on a fresh interpreter together with
+// the toolchain preludes of its project. Parse and runtime errors are published as diagnostics,
+// and the resulting top-level scope answers hover, go-to-definition and completion requests.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"gismolang.org/compiler/interpreter"
+	"gismolang.org/compiler/tokenizer"
+	"gismolang.org/compiler/tokenizer/tokentype"
+	"gismolang.org/compiler/toolchain"
+)
+
+// analysisTimeout stops programs that do not terminate (e.g. a $WHILE being typed).
+const analysisTimeout = 5 * time.Second
+
+// Maximum number of definitions shown in a hover.
+const maxHoverDefinitions = 20
+
+// document is an open text document and the result of its last analysis.
+type document struct {
+	uri    string
+	path   string
+	text   string
+	tokens []*tokenizer.Token
+	scope  *interpreter.Scope
+	lines  map[string][]string // Lines of the other files that definitions point into, read on demand
+}
+
+type server struct {
+	conn      *connection
+	documents map[string]*document
+}
+
+// Serve runs the language server on the given streams until the client sends exit or closes the input.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		conn:      newConnection(in, out),
+		documents: make(map[string]*document),
+	}
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		var malformed *malformedMessageError
+		if errors.As(err, &malformed) {
+			s.conn.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if err != nil {
+			s.conn.replyError(nil, codeParseError, err.Error())
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *server) handle(msg *message) {
+	var result interface{}
+	var err error
+
+	switch msg.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // Full document sync
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"$"},
+				},
+			},
+			"serverInfo": map[string]string{"name": "gismo"},
+		}
+	case "shutdown":
+		result = nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []diagnostic{},
+			})
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.definition(params)
+		}
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result = s.completion(params)
+		}
+	default:
+		if msg.ID != nil {
+			s.conn.replyError(msg.ID, codeMethodNotFound, "method not supported: "+msg.Method)
+		}
+		return
+	}
+
+	if msg.ID == nil {
+		return
+	}
+	if err != nil {
+		s.conn.replyError(msg.ID, codeInvalidParams, err.Error())
+		return
+	}
+	s.conn.reply(msg.ID, result)
+}
+
+// update stores the new text of a document, analyzes it and publishes its diagnostics.
+func (s *server) update(uri string, text string) {
+	doc := &document{uri: uri, path: uriToPath(uri), text: text}
+	doc.tokens = tokenizer.Tokenize(text, doc.path)
+	diagnostics := doc.analyze()
+	if diagnostics == nil {
+		diagnostics = []diagnostic{} // The protocol requires an array
+	}
+	s.documents[uri] = doc
+
+	s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// analyze runs the document with the toolchain of its project and returns its diagnostics.
+//
+// The project root is the closest directory above the document containing a toolchain directory.
+// Files inside the toolchain are not run on their own, since they only make sense when loaded
+// by the preludes; they are checked for syntax errors and through the errors of the prelude run.
+//
+// A document with syntax errors is still run as far as it parsed, so hover, definition and
+// completion keep working while it is being edited. Its runtime errors are not reported then,
+// since they are mostly consequences of the syntax errors.
+func (doc *document) analyze() (diagnostics []diagnostic) {
+	ctx, cancel := context.WithTimeout(context.Background(), analysisTimeout)
+	defer cancel()
+	interp := interpreter.NewInterpreter(ctx, nil, nil)
+	doc.scope = interp.Scope()
+	defer func() {
+		diagnostics = append(diagnostics, doc.warningDiagnostics(interp)...)
+	}()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			diagnostics = append(diagnostics, doc.newDiagnostic(nil, fmt.Sprintf("internal error: %v", recovered)))
+		}
+	}()
+
+	// The preludes run first, so operator precedences they declare apply to the document
+	tc := findToolchain(filepath.Dir(doc.path))
+	preludeFailed := false
+	if tc != nil {
+		for _, preludePath := range tc.Before {
+			preludeCode := doc.text
+			if !sameFile(preludePath, doc.path) {
+				if bytes, err := os.ReadFile(preludePath); err == nil {
+					preludeCode = string(bytes)
+				}
+			}
+			var preludeDiagnostics []diagnostic
+			preludeDiagnostics, preludeFailed = doc.run(interp, preludeCode, preludePath)
+			diagnostics = append(diagnostics, preludeDiagnostics...)
+			if preludeFailed {
+				break
+			}
+		}
+	}
+
+	ast, syntaxErrors := interp.Parse(doc.text, doc.path)
+	for _, syntaxError := range syntaxErrors {
+		diagnostics = append(diagnostics, doc.newDiagnostic(syntaxError.Token, syntaxError.Message()))
+	}
+	if preludeFailed {
+		return diagnostics
+	}
+
+	isToolchainFile := tc != nil && strings.HasPrefix(doc.path, tc.Dir+string(filepath.Separator))
+	if !isToolchainFile {
+		if err := interp.RunSource(ast, doc.path); err != nil && len(syntaxErrors) == 0 {
+			diagnostics = append(diagnostics, doc.runtimeDiagnostic(err))
+		}
+	}
+	return diagnostics
+}
+
+// run parses and runs a prelude. It returns the resulting diagnostics and whether it failed.
+// Syntax errors in the document itself are skipped, since the document is parsed separately.
+func (doc *document) run(interp *interpreter.Interpreter, code string, source string) ([]diagnostic, bool) {
+	ast, syntaxErrors := interp.Parse(code, source)
+	if len(syntaxErrors) > 0 {
+		var diagnostics []diagnostic
+		for _, syntaxError := range syntaxErrors {
+			if sameFile(syntaxError.Source, doc.path) {
+				continue // already reported while parsing the document itself
+			}
+			diagnostics = append(diagnostics, doc.newDiagnostic(syntaxError.Token, syntaxError.Message()))
+		}
+		return diagnostics, true
+	}
+	if err := interp.RunSource(ast, source); err != nil {
+		return []diagnostic{doc.runtimeDiagnostic(err)}, true
+	}
+	return nil, false
+}
+
+func (doc *document) runtimeDiagnostic(err error) diagnostic {
+	var token *tokenizer.Token
+	if raised, ok := err.(*interpreter.Error); ok {
+		token = raised.Token
+	}
+	return doc.newDiagnostic(token, err.Error())
+}
+
+// warningDiagnostics returns the warnings reported inside the document.
+// Warnings in other files, e.g. the toolchain, are left out to avoid noise.
+func (doc *document) warningDiagnostics(interp *interpreter.Interpreter) []diagnostic {
+	var diagnostics []diagnostic
+	for _, warning := range interp.Warnings() {
+		if warning.Token == nil || !sameFile(warning.Token.Source, doc.path) {
+			continue
+		}
+		result := doc.newDiagnostic(warning.Token, warning.Message)
+		result.Severity = severityWarning
+		result.Code = warning.Code
+		diagnostics = append(diagnostics, result)
+	}
+	return diagnostics
+}
+
+// newDiagnostic creates a diagnostic at the token.
+// Errors located in other files are shown on the first line of the document.
+func (doc *document) newDiagnostic(token *tokenizer.Token, message string) diagnostic {
+	result := diagnostic{Severity: severityError, Source: "gismo", Message: message}
+	if token == nil || token.Line == 0 {
+		return result
+	}
+	if !sameFile(token.Source, doc.path) {
+		result.Message = fmt.Sprintf("%s:%d:%d: %s", token.Source, token.Line, token.Column, message)
+		return result
+	}
+	result.Range = doc.tokenRange(token)
+	return result
+}
+
+func (s *server) hover(params textDocumentPositionParams) *hover {
+	doc, token := s.tokenAt(params)
+	if token == nil {
+		return nil
+	}
+	definitions := doc.scope.LookupDefinitions(token.Value)
+	if len(definitions) == 0 {
+		return nil
+	}
+
+	var builder strings.Builder
+	for i, definition := range definitions {
+		if i == maxHoverDefinitions {
+			builder.WriteString(fmt.Sprintf("… and %d more\n", len(definitions)-i))
+			break
+		}
+		body := definition.Value
+		if len(body) > 120 {
+			body = body[:120] + " …"
+		}
+		builder.WriteString("```gismo\n" + definition.Signature + " ::= " + body + "\n```\n")
+		if definition.Doc != "" {
+			builder.WriteString(definition.Doc + "\n\n")
+		}
+		if definition.Token != nil {
+			builder.WriteString(fmt.Sprintf("*defined at %s:%d*\n\n", definition.Token.Source, definition.Token.Line))
+		}
+	}
+
+	tokenRange := doc.tokenRange(token)
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: builder.String()},
+		Range:    &tokenRange,
+	}
+}
+
+func (s *server) definition(params textDocumentPositionParams) []location {
+	doc, token := s.tokenAt(params)
+	locations := []location{}
+	if token == nil {
+		return locations
+	}
+	for _, definition := range doc.scope.LookupDefinitions(token.Value) {
+		if definition.Token == nil || definition.Token.Line == 0 {
+			continue // builtin
+		}
+		locations = append(locations, location{
+			URI:   pathToURI(definition.Token.Source),
+			Range: doc.tokenRange(definition.Token),
+		})
+	}
+	return locations
+}
+
+func (s *server) completion(params textDocumentPositionParams) []completionItem {
+	items := []completionItem{}
+	doc, found := s.documents[params.TextDocument.URI]
+	if !found {
+		return items
+	}
+	prefix := wordBefore(doc.text, params.Position)
+
+	for _, name := range doc.scope.DefinedNames() {
+		if !strings.HasPrefix(name, prefix) || strings.HasPrefix(name, "@") {
+			continue
+		}
+		item := completionItem{Label: name, Kind: completionKindFunction}
+		if !isWord(name) {
+			item.Kind = completionKindOperator
+		}
+		if suggestions := doc.scope.MacroSuggestions(name); len(suggestions) > 0 {
+			item.Detail = suggestions[0]
+			item.Documentation = &markupContent{
+				Kind:  "markdown",
+				Value: "```gismo\n" + strings.Join(suggestions, "\n") + "\n```",
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// tokenAt returns the operator or identifier token at the requested position.
+func (s *server) tokenAt(params textDocumentPositionParams) (*document, *tokenizer.Token) {
+	doc, found := s.documents[params.TextDocument.URI]
+	if !found || doc.scope == nil {
+		return nil, nil
+	}
+	for _, token := range doc.tokens {
+		if token.TokenType != tokentype.Operator && token.TokenType != tokentype.Identifier {
+			continue
+		}
+		tokenRange := doc.tokenRange(token)
+		if tokenRange.Start.Line == params.Position.Line &&
+			tokenRange.Start.Character <= params.Position.Character &&
+			params.Position.Character <= tokenRange.End.Character {
+			return doc, token
+		}
+	}
+	return doc, nil
+}
+
+// tokenRange converts the 1-based token position to a 0-based LSP range.
+// Token columns count runes while LSP counts UTF-16 code units, so the columns are converted
+// with the text of the token's line.
+func (doc *document) tokenRange(token *tokenizer.Token) textRange {
+	line := doc.sourceLine(token.Source, token.Line)
+	startLine := token.Line - 1
+	if startLine < 0 {
+		startLine = 0
+	}
+	startColumn := token.Column - 1
+	if startColumn < 0 {
+		startColumn = 0
+	}
+	return textRange{
+		Start: position{Line: startLine, Character: utf16Offset(line, startColumn)},
+		End:   position{Line: startLine, Character: utf16Offset(line, startColumn+token.Width())},
+	}
+}
+
+// sourceLine returns the 1-based line of the document or of another file, or nil if there is none.
+func (doc *document) sourceLine(source string, line int) []rune {
+	var lines []string
+	if sameFile(source, doc.path) {
+		lines = strings.Split(doc.text, "\n")
+	} else {
+		if doc.lines == nil {
+			doc.lines = make(map[string][]string)
+		}
+		cached, found := doc.lines[source]
+		if !found {
+			if bytes, err := os.ReadFile(source); err == nil {
+				cached = strings.Split(string(bytes), "\n")
+			}
+			doc.lines[source] = cached
+		}
+		lines = cached
+	}
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	return []rune(lines[line-1])
+}
+
+// utf16Offset returns the number of UTF-16 code units in the first n runes of the line.
+// Runes past the end of the line count as one unit each.
+func utf16Offset(line []rune, n int) int {
+	offset := 0
+	for i := 0; i < n; i++ {
+		if i < len(line) {
+			offset += utf16Length(line[i])
+		} else {
+			offset++
+		}
+	}
+	return offset
+}
+
+// runeIndex returns the number of runes of the line that come before the UTF-16 offset.
+func runeIndex(line []rune, offset int) int {
+	units := 0
+	for i, r := range line {
+		if units >= offset {
+			return i
+		}
+		units += utf16Length(r)
+	}
+	return len(line)
+}
+
+// utf16Length returns the number of UTF-16 code units of the rune; invalid runes are replaced by one unit.
+func utf16Length(r rune) int {
+	if utf16.RuneLen(r) == 2 {
+		return 2
+	}
+	return 1
+}
+
+// wordBefore returns the identifier characters directly before the position.
+func wordBefore(text string, pos position) string {
+	lines := strings.Split(text, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return ""
+	}
+	line := []rune(lines[pos.Line])
+	end := runeIndex(line, pos.Character)
+	start := end
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	return string(line[start:end])
+}
+
+func isWord(name string) bool {
+	for _, r := range name {
+		if !isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// findToolchain returns the toolchain in GISMO_TOOLCHAIN or else the closest toolchain directory above dir.
+// It returns nil if there is none.
+func findToolchain(dir string) *toolchain.Toolchain {
+	if envDir := os.Getenv(toolchain.EnvVar); envDir != "" {
+		if absDir, err := filepath.Abs(envDir); err == nil {
+			if tc, err := toolchain.Load(absDir); err == nil {
+				return tc
+			}
+		}
+	}
+	for {
+		if tc, err := toolchain.Load(filepath.Join(dir, toolchain.DefaultDir)); err == nil {
+			return tc
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+func sameFile(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,110 @@
+package lsp
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func frame(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func newTestServer() (*server, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &server{conn: newConnection(strings.NewReader(""), out), documents: make(map[string]*document)}, out
+}
+
+func TestMalformedMessageKeepsServing(t *testing.T) {
+	in := frame(`{"id": 1, "method": `) + frame(`{"jsonrpc": "2.0", "id": 2, "method": "shutdown"}`)
+	out := &bytes.Buffer{}
+	if err := Serve(strings.NewReader(in), out); err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+	if !strings.Contains(out.String(), `"code":-32700`) {
+		t.Errorf("expected a parse error reply, got %s", out)
+	}
+	if !strings.Contains(out.String(), `"id":2,"result":null`) {
+		t.Errorf("expected a reply to the request after the malformed one, got %s", out)
+	}
+}
+
+func TestHoverWithSyntaxErrors(t *testing.T) {
+	s, _ := newTestServer()
+	uri := pathToURI(filepath.Join(t.TempDir(), "a.gsm"))
+	s.update(uri, "answer ::= 42\nbroken(1\nanswer\n")
+	result := s.hover(textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     position{Line: 2, Character: 1},
+	})
+	if result == nil || !strings.Contains(result.Contents.Value, "answer ::= 42") {
+		t.Errorf("expected a hover for answer, got %v", result)
+	}
+}
+
+func TestTokenRangeCountsUTF16(t *testing.T) {
+	s, _ := newTestServer()
+	uri := pathToURI(filepath.Join(t.TempDir(), "a.gsm"))
+	s.update(uri, "\"😀\" + é\n")
+	doc := s.documents[uri]
+	expected := []textRange{
+		{Start: position{0, 0}, End: position{0, 4}},
+		{Start: position{0, 5}, End: position{0, 6}},
+		{Start: position{0, 7}, End: position{0, 8}},
+	}
+	for i, want := range expected {
+		if got := doc.tokenRange(doc.tokens[i]); got != want {
+			t.Errorf("token %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+const callFormSource = `sq ::= $TYPEDEF($NIL(), sq)
+/// squares
+sq(int) ::= $MUL($2, $2)
+sq(3)
+`
+
+func TestHoverShowsCallFormMacros(t *testing.T) {
+	s, _ := newTestServer()
+	uri := pathToURI(filepath.Join(t.TempDir(), "a.gsm"))
+	s.update(uri, callFormSource)
+	result := s.hover(textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     position{Line: 3, Character: 1},
+	})
+	if result == nil || !strings.Contains(result.Contents.Value, "sq(int) ::=") || !strings.Contains(result.Contents.Value, "squares") {
+		t.Errorf("expected a hover with sq(int) and its doc comment, got %v", result)
+	}
+}
+
+func TestDefinitionFindsCallFormMacros(t *testing.T) {
+	s, _ := newTestServer()
+	uri := pathToURI(filepath.Join(t.TempDir(), "a.gsm"))
+	s.update(uri, callFormSource)
+	locations := s.definition(textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     position{Line: 3, Character: 1},
+	})
+	if len(locations) == 0 || locations[0].Range.Start.Line != 2 {
+		t.Errorf("expected the sq(int) definition on line 2 first, got %v", locations)
+	}
+}
+
+func TestCompletionListsCallFormMacros(t *testing.T) {
+	s, _ := newTestServer()
+	uri := pathToURI(filepath.Join(t.TempDir(), "a.gsm"))
+	s.update(uri, callFormSource)
+	items := s.completion(textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri},
+		Position:     position{Line: 3, Character: 2},
+	})
+	for _, item := range items {
+		if item.Label == "sq" && item.Detail == "sq(int)" {
+			return
+		}
+	}
+	t.Errorf("expected a completion for sq(int), got %v", items)
+}
@@ -1,20 +1,39 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"gismolang.org/compiler/config"
 	"gismolang.org/compiler/interpreter"
+	"gismolang.org/compiler/lsp"
 	"gismolang.org/compiler/parser"
-	"gismolang.org/compiler/tokenizer"
-	"gismolang.org/compiler/tokenizer/tokentype"
+	"gismolang.org/compiler/report"
+	"gismolang.org/compiler/toolchain"
 )
 
 func main() {
+    if len(os.Args) > 1 && os.Args[1] == "repl" {
+        runRepl()
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "lsp" {
+        if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
     // 1. Define the "-o" flag (we'll also accept it after the file path)
     flag.StringVar(&config.OutputPath, "o", config.OutputPath, "Output file path")
+    flag.BoolVar(&config.TraceExpansion, "trace-expansion", config.TraceExpansion, "Log every macro dispatch to stderr")
+    flag.StringVar(&config.ToolchainDir, "toolchain", config.ToolchainDir, "Toolchain directory (default $GISMO_TOOLCHAIN or ./toolchain)")
+    flag.StringVar(&config.DiagnosticsFormat, "diagnostics", config.DiagnosticsFormat, "Format of diagnostics written to stderr: text, json or sarif")
 
     // Pre-scan os.Args so "-o" and "-o=..." work even after the <file-path>.
     args := os.Args[1:]
@@ -38,6 +57,12 @@ func main() {
             continue
         }
 
+        // "-Werror", "-W<code>" and "-Wno-<code>" are not valid Go flags
+        if len(a) > 2 && a[:2] == "-W" {
+            config.WarningFlags = append(config.WarningFlags, a[2:])
+            continue
+        }
+
         cleaned = append(cleaned, a)
     }
 
@@ -45,6 +70,12 @@ func main() {
     os.Args = append([]string{os.Args[0]}, cleaned...)
     flag.Parse()
 
+    format, err := report.ParseFormat(config.DiagnosticsFormat)
+    if err != nil {
+        log.Fatal(err)
+    }
+    diagnosticsFormat = format
+
     file := "ENVIRONMENT"
     code := os.Getenv("GISMO_CODE")
     config.OutputEnabled = os.Getenv("NO_OUT") == ""
@@ -53,7 +84,7 @@ func main() {
         // 2. Ensure a file argument is passed
         // flag.NArg() returns the number of arguments remaining after flags are parsed.
         if flag.NArg() < 1 {
-            log.Fatal("Usage: gismo [-o <output-path>] <file-path>")
+            log.Fatal("Usage: gismo [-o <output-path>] [--toolchain <dir>] [--diagnostics=text|json|sarif] [-Werror] [-W[no-]<code>] <file-path>\n       gismo repl\n       gismo lsp")
         }
 
         // 3. Read file content
@@ -67,27 +98,121 @@ func main() {
         code = string(text)
     }
 
-    before, _ := os.ReadFile(config.BeforePath)
-    after, _ := os.ReadFile(config.AfterPath)
+    tc, err := toolchain.Find(config.ToolchainDir)
+    if err != nil {
+        log.Fatal(err)
+    }
+    before := readFiles(tc.Before)
+    after := readFiles(tc.After)
 
-    // Tokenize the file content
-    tokens := []*tokenizer.Token{}
-    if before != nil {
-        tokens = append(tokens, tokenizer.Tokenize(string(before), config.BeforePath)...)
-        tokens = append(tokens, &tokenizer.Token{TokenType: tokentype.Newline})
+    config.Init()
+    defer config.Deinit()
+
+    var output io.Writer
+    if config.OutputFile != nil {
+        output = config.OutputFile
+    }
+    interp := interpreter.NewInterpreter(context.Background(), output, os.Stdout)
+    interp.SetTraceOutput(os.Stderr) // Kept apart from the program and compiler output
+    if config.TraceExpansion {
+        interp.SetTrace(os.Stderr)
+    }
+    for _, warningFlag := range config.WarningFlags {
+        switch {
+        case warningFlag == "error":
+            interp.SetWarningsAsErrors(true)
+        case strings.HasPrefix(warningFlag, "no-"):
+            interp.SetWarningEnabled(strings.TrimPrefix(warningFlag, "no-"), false)
+        default:
+            interp.SetWarningEnabled(warningFlag, true)
+        }
+    }
+
+    // Each file is parsed right before it runs, so operator precedences declared
+    // with $PRECEDENCE in the toolchain apply to the files that follow it.
+    for i, path := range tc.Before {
+        interpretSource(interp, before[i], path)
     }
 
-    tokens = append(tokens, tokenizer.Tokenize(code, file)...)
+    interpretSource(interp, code, file)
 
-    if after != nil {
-        tokens = append(tokens, &tokenizer.Token{TokenType: tokentype.Newline})
-        tokens = append(tokens, tokenizer.Tokenize(string(after), config.AfterPath)...)
+    for i, path := range tc.After {
+        interpretSource(interp, after[i], path)
     }
 
-    // Parse the tokens into an AST
-    ast := parser.Parse(tokens, file)
+    reportDiagnostics(interp, nil, nil)
+    if interp.WarningsAsErrors() && len(interp.Warnings()) > 0 {
+        exit(1)
+    }
+}
 
-    config.Init()
-    defer config.Deinit()
-    interpreter.Interpret(ast)
-}
\ No newline at end of file
+// diagnosticsFormat selects how errors are written to stderr.
+var diagnosticsFormat = report.FormatText
+
+// readFiles reads toolchain files. They are read before the output file is created,
+// so a broken toolchain does not leave an empty output behind.
+func readFiles(paths []string) []string {
+    contents := make([]string, len(paths))
+    for i, path := range paths {
+        text, err := os.ReadFile(path)
+        if err != nil {
+            log.Fatalf("Failed to read toolchain file '%s': %v", path, err)
+        }
+        contents[i] = string(text)
+    }
+    return contents
+}
+
+// interpretSource parses the code and runs it in the top-level scope of the interpreter.
+// It exits after reporting the diagnostics if the code fails.
+func interpretSource(interp *interpreter.Interpreter, code string, source string) {
+    ast, syntaxErrors := interp.Parse(code, source)
+    if len(syntaxErrors) > 0 {
+        reportDiagnostics(interp, syntaxErrors, nil)
+        exit(1)
+    }
+    if err := interp.RunSource(ast, source); err != nil {
+        reportDiagnostics(interp, nil, err)
+        exit(1)
+    }
+}
+
+// reportDiagnostics writes the warnings and the errors (if any) to stderr in the selected format,
+// so they do not interleave with $PRINTLN output. The text format ends with a warning count.
+func reportDiagnostics(interp *interpreter.Interpreter, syntaxErrors []parser.Diagnostic, err error) {
+    warnings := interp.Warnings()
+    if diagnosticsFormat == report.FormatText {
+        interp.RenderWarnings(os.Stderr)
+        if len(syntaxErrors) > 0 {
+            interp.RenderSyntaxErrors(os.Stderr, syntaxErrors)
+        }
+        if err != nil {
+            interp.RenderError(os.Stderr, err)
+        }
+        if len(warnings) > 0 && interp.WarningsAsErrors() {
+            fmt.Fprintf(os.Stderr, "%d warning(s) treated as errors\n", len(warnings))
+        } else if len(warnings) > 0 {
+            fmt.Fprintf(os.Stderr, "%d warning(s)\n", len(warnings))
+        }
+        return
+    }
+
+    diagnostics := report.FromWarnings(warnings, interp.WarningsAsErrors())
+    diagnostics = append(diagnostics, report.FromSyntaxErrors(syntaxErrors)...)
+    if err != nil {
+        diagnostics = append(diagnostics, report.FromError(err))
+    }
+    write := report.WriteJSON
+    if diagnosticsFormat == report.FormatSARIF {
+        write = report.WriteSARIF
+    }
+    if err := write(os.Stderr, diagnostics); err != nil {
+        log.Print(err)
+    }
+}
+
+// exit closes the output file and terminates the process.
+func exit(code int) {
+    config.Deinit()
+    os.Exit(code)
+}
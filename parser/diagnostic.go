@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"fmt"
+
+	"gismolang.org/compiler/tokenizer"
+	"gismolang.org/compiler/tokenizer/tokentype"
+)
+
+// Diagnostic describes a syntax error found while parsing.
+type Diagnostic struct {
+	Source   string
+	Line     int
+	Column   int
+	Expected string
+	Found    string
+	Token    *tokenizer.Token // Token at which the error was detected
+}
+
+// newDiagnostic creates a diagnostic for the given token.
+// A line break or the end-of-input sentinel has no useful position of its own, so the diagnostic is
+// placed at the last real token before it instead.
+func newDiagnostic(r *TokenReader, token *tokenizer.Token, expected string) Diagnostic {
+	position := token
+	if isLineEnd(token) {
+		position = r.lastRealTokenBefore(token)
+	}
+	return Diagnostic{
+		Source:   position.Source,
+		Line:     position.Line,
+		Column:   position.Column,
+		Expected: expected,
+		Found:    describeToken(token),
+		Token:    position,
+	}
+}
+
+func isLineEnd(token *tokenizer.Token) bool {
+	return token.TokenType == tokentype.None || (token.TokenType == tokentype.Newline && token.Value != ";")
+}
+
+// Message returns the error message without the source location.
+func (diagnostic Diagnostic) Message() string {
+	if diagnostic.Expected == "" {
+		return fmt.Sprintf("unexpected %s", diagnostic.Found)
+	}
+	return fmt.Sprintf("expected %s, found %s", diagnostic.Expected, diagnostic.Found)
+}
+
+// String returns the diagnostic in the form "source:line:column: message".
+func (diagnostic Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", diagnostic.Source, diagnostic.Line, diagnostic.Column, diagnostic.Message())
+}
+
+// describeToken returns a human readable description of a token for error messages.
+func describeToken(token *tokenizer.Token) string {
+	switch token.TokenType {
+	case tokentype.None:
+		return "end of file"
+	case tokentype.Newline:
+		if token.Value == ";" {
+			return "';'"
+		}
+		return "newline"
+	case tokentype.String:
+		return fmt.Sprintf("string \"%s\"", token.Value)
+	case tokentype.Illegal:
+		return fmt.Sprintf("'%s' without a closing '*/'", token.Value)
+	default:
+		return fmt.Sprintf("'%s'", token.Value)
+	}
+}
@@ -12,8 +12,18 @@ type SyntaxNode struct {
     Operator  *SyntaxNode
     Arguments []*SyntaxNode
     Value     *tokenizer.Token
+    Closing   *tokenizer.Token // Closing bracket of a block, list or call, nil if it is missing
 }
 
+// Operators of the forms that calls, blocks and square brackets are parsed into.
+const (
+    CallOperator      = "@call"      // f(a, b)
+    CurlyCallOperator = "@callCurly" // f{ statements }
+    BlockOperator     = "@begin"     // { a; b }
+    ListOperator      = "@list"      // [a, b, c]
+    IndexOperator     = "@index"     // v[i]
+)
+
 // NewValueNode creates a new syntax node for a literal value.
 func NewValueNode(value *tokenizer.Token) *SyntaxNode {
     return &SyntaxNode{
@@ -32,24 +42,41 @@ func NewSExpression(operator *SyntaxNode, arguments []*SyntaxNode) *SyntaxNode {
     }
 }
 
+// withClosing records the closing bracket of the node, so its span covers the whole node.
+func withClosing(node *SyntaxNode, closing *tokenizer.Token) *SyntaxNode {
+    node.Closing = closing
+    return node
+}
+
 // Parse generates an AST from a list of tokens.
-func Parse(tokens []*tokenizer.Token, source string) *SyntaxNode {
+// Syntax errors do not stop the parser: it resynchronizes at the next statement
+// and returns every error it found alongside the (partial) tree.
+func Parse(tokens []*tokenizer.Token, source string) (*SyntaxNode, []Diagnostic) {
     r := CreateTokenReader(tokens)
-    return NewSExpression(NewValueNode(tokenizer.ModuleToken(source)), parseExpressions(&r))
+    module := NewSExpression(NewValueNode(tokenizer.ModuleToken(source)), parseExpressions(&r, tokentype.None))
+    return module, r.diagnostics
 }
 
-// parseExpressions parses a series of expressions.
-func parseExpressions(r *TokenReader) []*SyntaxNode {
+// parseExpressions parses a series of expressions until the terminator token type is reached.
+// The terminator itself is not consumed.
+func parseExpressions(r *TokenReader, terminator tokentype.TokenType) []*SyntaxNode {
     var expressions []*SyntaxNode
     for {
         node := parseExpression(r, 0)
         if node != nil {
             expressions = append(expressions, node)
         }
-        if r.PeekNext(0).TokenType != tokentype.Newline && r.PeekNext(0).TokenType != tokentype.Semicolon {
+        next := r.PeekNext(0)
+        if next.TokenType == tokentype.Newline || next.TokenType == tokentype.Semicolon {
+            r.Next() // consume newline or semicolon
+            continue
+        }
+        if next.TokenType == terminator || next.TokenType == tokentype.None {
             break
         }
-        r.Next() // consume newline or semicolon
+        // Unexpected token: report it, skip the rest of the statement and keep going
+        r.report(r.Next(), "")
+        r.synchronize()
     }
     return expressions
 }
@@ -93,6 +120,16 @@ func parseExpression(r *TokenReader, parentPrecedence int) *SyntaxNode {
             continue
         }
 
+        // Handle index/subscript calls with the same precedence as function calls
+        if r.PeekNext(0).TokenType == tokentype.LSquaredParent {
+            precedence := tokenizer.FunctionCallPrecedence
+            if precedence < parentPrecedence {
+                break
+            }
+            left = parseIndexCall(r, left)
+            continue
+        }
+
         // Handle curly function calls with higher precedence
         if r.PeekNext(0).TokenType == tokentype.LCurlyParent {
             precedence := tokenizer.CurlyCallPrecedence // Assign higher precedence than dot operator
@@ -117,7 +154,12 @@ func parseExpression(r *TokenReader, parentPrecedence int) *SyntaxNode {
             skipNewlines(r)
         }
 
-        right := parseExpression(r, precedence+1)
+        // Right-associative operators accept an operand of the same precedence on their right
+        rightPrecedence := precedence + 1
+        if operator.RightAssoc {
+            rightPrecedence = precedence
+        }
+        right := parseExpression(r, rightPrecedence)
         if right == nil {
             left = NewSExpression(NewValueNode(operator), []*SyntaxNode{left})
         } else {
@@ -137,8 +179,8 @@ func parseParentCall(r *TokenReader, left *SyntaxNode) *SyntaxNode {
 
     if r.PeekNext(0).TokenType == tokentype.RParent {
         r.Next()
-        lparent.Alias = "@call"
-        return NewSExpression(NewValueNode(lparent), []*SyntaxNode{left})
+        lparent.Alias = CallOperator
+        return withClosing(NewSExpression(NewValueNode(lparent), []*SyntaxNode{left}), r.PeekNext(-1))
     } else {
         arguments := parseExpression(r, 0)
         
@@ -146,14 +188,27 @@ func parseParentCall(r *TokenReader, left *SyntaxNode) *SyntaxNode {
         // Handles: func( arg \n )
         skipNewlines(r)
         
-        if r.Next().TokenType != tokentype.RParent {
-            panic("Expected closing parenthesis")
-        }
-        lparent.Alias = "@call"
-        return NewSExpression(NewValueNode(lparent), []*SyntaxNode{left, arguments})
+        closing := r.expectClosing(tokentype.RParent, "')'")
+        lparent.Alias = CallOperator
+        return withClosing(NewSExpression(NewValueNode(lparent), []*SyntaxNode{left, arguments}), closing)
     }
 }
 
+// parseIndexCall parses a subscript like v[i] into an @index form.
+func parseIndexCall(r *TokenReader, left *SyntaxNode) *SyntaxNode {
+    lbracket := r.Next()
+    lbracket.Alias = IndexOperator
+    skipNewlines(r)
+
+    if r.PeekNext(0).TokenType == tokentype.RSquaredParent {
+        return withClosing(NewSExpression(NewValueNode(lbracket), []*SyntaxNode{left}), r.Next())
+    }
+    arguments := parseExpression(r, 0)
+    skipNewlines(r)
+    closing := r.expectClosing(tokentype.RSquaredParent, "']'")
+    return withClosing(NewSExpression(NewValueNode(lbracket), []*SyntaxNode{left, arguments}), closing)
+}
+
 func parseCurlyParentCall(r *TokenReader, left *SyntaxNode) *SyntaxNode {
     lparent := r.Next()
     
@@ -162,15 +217,13 @@ func parseCurlyParentCall(r *TokenReader, left *SyntaxNode) *SyntaxNode {
 
     if r.PeekNext(0).TokenType == tokentype.RCurlyParent {
         r.Next() 
-        lparent.Alias = "@callCurly"
-        return NewSExpression(NewValueNode(lparent), []*SyntaxNode{left})
+        lparent.Alias = CurlyCallOperator
+        return withClosing(NewSExpression(NewValueNode(lparent), []*SyntaxNode{left}), r.PeekNext(-1))
     } else {
-        arguments := parseExpressions(r)
-        if r.Next().TokenType != tokentype.RCurlyParent {
-            panic("Expected closing curly parenthesis")
-        }
-        lparent.Alias = "@callCurly"
-        return NewSExpression(NewValueNode(lparent), append([]*SyntaxNode{left}, arguments...))
+        arguments := parseExpressions(r, tokentype.RCurlyParent)
+        closing := r.expectClosing(tokentype.RCurlyParent, "'}'")
+        lparent.Alias = CurlyCallOperator
+        return withClosing(NewSExpression(NewValueNode(lparent), append([]*SyntaxNode{left}, arguments...)), closing)
     }
 }
 
@@ -184,18 +237,25 @@ func parseLiteral(r *TokenReader) *SyntaxNode {
         skipNewlines(r) // Allow newline after '(' in grouped expression
         expr := parseExpression(r, 0)
         skipNewlines(r) // Allow newline before ')' in grouped expression
-        if r.Next().TokenType != tokentype.RParent {
-            panic("Missing closing parenthesis")
-        }
+        r.expect(tokentype.RParent, "')'")
         return expr
-    case tokentype.LCurlyParent:
+    case tokentype.LSquaredParent:
         operator := r.Next()
-        statements := parseExpressions(r)
-        if r.Next().TokenType != tokentype.RCurlyParent {
-            panic("Missing closing curly brace")
+        operator.Alias = ListOperator
+        skipNewlines(r)
+        if r.PeekNext(0).TokenType == tokentype.RSquaredParent {
+            return withClosing(NewSExpression(NewValueNode(operator), []*SyntaxNode{}), r.Next())
         }
-        operator.Alias = "@begin"
-        return NewSExpression(NewValueNode(operator), statements)
+        elements := parseExpression(r, 0)
+        skipNewlines(r)
+        closing := r.expectClosing(tokentype.RSquaredParent, "']'")
+        return withClosing(NewSExpression(NewValueNode(operator), []*SyntaxNode{elements}), closing)
+    case tokentype.LCurlyParent:
+        operator := r.Next()
+        statements := parseExpressions(r, tokentype.RCurlyParent)
+        closing := r.expectClosing(tokentype.RCurlyParent, "'}'")
+        operator.Alias = BlockOperator
+        return withClosing(NewSExpression(NewValueNode(operator), statements), closing)
     default:
         return nil
     }
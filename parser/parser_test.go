@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"testing"
+
+	"gismolang.org/compiler/tokenizer"
+)
+
+func parseDiagnostics(t *testing.T, code string) []Diagnostic {
+	t.Helper()
+	_, diagnostics := Parse(tokenizer.Tokenize(code, "test.gsm"), "test.gsm")
+	return diagnostics
+}
+
+func expectPositions(t *testing.T, code string, positions ...[2]int) {
+	t.Helper()
+	diagnostics := parseDiagnostics(t, code)
+	if len(diagnostics) != len(positions) {
+		t.Fatalf("expected %d diagnostics, got %d: %v", len(positions), len(diagnostics), diagnostics)
+	}
+	for i, position := range positions {
+		if diagnostics[i].Line != position[0] || diagnostics[i].Column != position[1] {
+			t.Errorf("diagnostic %d: expected %d:%d, got %s", i, position[0], position[1], diagnostics[i])
+		}
+	}
+}
+
+func TestUnclosedCallsReportEachLine(t *testing.T) {
+	expectPositions(t, "f(1, 2\ng(3\nx ::= { a(1 }\ny ::= (2\n",
+		[2]int{2, 1}, [2]int{3, 1}, [2]int{3, 13}, [2]int{4, 8})
+}
+
+func TestUnclosedCallsInBlockReportEachLine(t *testing.T) {
+	expectPositions(t, "a ::= {\n  f(1\n  g(2\n}\nh(3\nk(4\n",
+		[2]int{3, 3}, [2]int{4, 1}, [2]int{6, 1}, [2]int{6, 3})
+}
+
+func TestEndOfFileIsAnchoredToLastToken(t *testing.T) {
+	diagnostics := parseDiagnostics(t, "y ::= (2\n\n\n")
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diagnostics)
+	}
+	if diagnostics[0].Line != 1 || diagnostics[0].Column != 8 || diagnostics[0].Found != "end of file" {
+		t.Errorf("expected end of file at 1:8, got %s", diagnostics[0])
+	}
+}
+
+func TestUnterminatedBlockCommentIsReported(t *testing.T) {
+	diagnostics := parseDiagnostics(t, "x ::= 1\n/* start\n  /* nested */\ny ::= 2\n")
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diagnostics)
+	}
+	if diagnostics[0].String() != "test.gsm:2:1: unexpected '/*' without a closing '*/'" {
+		t.Errorf("unexpected diagnostic %s", diagnostics[0])
+	}
+}
@@ -7,8 +7,9 @@ import (
 
 // TokenReader is used to traverse the list of tokens while parsing.
 type TokenReader struct {
-	tokens []*tokenizer.Token
-	ptr    int
+	tokens      []*tokenizer.Token
+	ptr         int
+	diagnostics []Diagnostic
 }
 
 // CreateTokenReader initializes and returns a new TokenReader.
@@ -36,4 +37,95 @@ func (tr *TokenReader) Next() *tokenizer.Token {
 	}
 	tr.ptr++
 	return tr.PeekNext(-1) // Return the previously pointed token
-}
\ No newline at end of file
+}
+
+// report records a syntax error at the given token.
+func (tr *TokenReader) report(token *tokenizer.Token, expected string) {
+	tr.diagnostics = append(tr.diagnostics, newDiagnostic(tr, token, expected))
+}
+
+// lastRealTokenBefore returns the last token up to the given one that is not a line break,
+// or the token itself if there is none.
+func (tr *TokenReader) lastRealTokenBefore(token *tokenizer.Token) *tokenizer.Token {
+	end := len(tr.tokens)
+	for i, candidate := range tr.tokens {
+		if candidate == token {
+			end = i + 1
+			break
+		}
+	}
+	for i := end - 1; i >= 0; i-- {
+		if !isLineEnd(tr.tokens[i]) {
+			return tr.tokens[i]
+		}
+	}
+	return token
+}
+
+// expect consumes the next token if it has the given type.
+// Otherwise it records a diagnostic and resynchronizes at the next statement boundary.
+func (tr *TokenReader) expect(tokenType tokentype.TokenType, expected string) bool {
+	if tr.PeekNext(0).TokenType == tokenType {
+		tr.Next()
+		return true
+	}
+	tr.report(tr.PeekNext(0), expected)
+	if !tr.rewindToLineBreak() {
+		tr.synchronize()
+	}
+	return false
+}
+
+// expectClosing consumes the closing bracket like expect and returns it, or nil if it is missing.
+func (tr *TokenReader) expectClosing(tokenType tokentype.TokenType, expected string) *tokenizer.Token {
+	if tr.expect(tokenType, expected) {
+		return tr.PeekNext(-1)
+	}
+	return nil
+}
+
+// rewindToLineBreak moves back over the line breaks skipped right before the current token.
+// An unclosed bracket then ends its statement at the end of its line, and the statement on the
+// next line is parsed on its own instead of being skipped. It reports false if there was none.
+func (tr *TokenReader) rewindToLineBreak() bool {
+	if tr.ptr == 0 || tr.PeekNext(-1).TokenType != tokentype.Newline {
+		return false
+	}
+	for tr.ptr > 0 && tr.PeekNext(-1).TokenType == tokentype.Newline {
+		tr.ptr--
+	}
+	return true
+}
+
+// synchronize skips tokens until the next newline or closing curly brace on the current nesting level.
+// The boundary token itself is not consumed, so the enclosing block can continue parsing after it.
+// If a block opened in the skipped tokens is never closed, it stops at the first newline instead,
+// so the statements after it are still parsed.
+func (tr *TokenReader) synchronize() {
+	firstNewline := -1
+	depth := 0
+	for {
+		switch tr.PeekNext(0).TokenType {
+		case tokentype.None:
+			if depth > 0 && firstNewline >= 0 {
+				tr.ptr = firstNewline
+			}
+			return
+		case tokentype.Newline:
+			if depth == 0 {
+				return
+			}
+			if firstNewline < 0 {
+				firstNewline = tr.ptr
+			}
+		case tokentype.LCurlyParent:
+			depth++
+		case tokentype.RCurlyParent:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+		tr.Next()
+	}
+}
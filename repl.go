@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"gismolang.org/compiler/interpreter"
+	"gismolang.org/compiler/tokenizer"
+	"gismolang.org/compiler/tokenizer/tokentype"
+	"gismolang.org/compiler/toolchain"
+)
+
+const replSource = "<repl>"
+
+// replInputs counts the evaluated inputs. Each input gets its own source name,
+// so errors in definitions from earlier inputs still show the right code.
+var replInputs int
+
+const replHelp = `Commands:
+  :scope          print all definitions
+  :load <file>    run a file in the current scope
+  :suggest <expr> list macros applicable to the value of expr
+  :reset          discard all definitions
+  :help           show this help
+  :quit           leave the REPL`
+
+// runRepl reads expressions from stdin and evaluates them in one persistent scope.
+// Input continues over several lines until all parentheses, brackets and braces are balanced.
+func runRepl() {
+	// $WRITE output goes to the terminal as well, so generated code can be inspected directly
+	interp := interpreter.NewInterpreter(context.Background(), os.Stdout, os.Stdout)
+	loadPrelude(interp)
+
+	fmt.Println("Gismo REPL. Type :help for commands.")
+	scanner := bufio.NewScanner(os.Stdin)
+	var input strings.Builder
+	for {
+		if input.Len() == 0 {
+			fmt.Print("gismo> ")
+		} else {
+			fmt.Print("  ...> ")
+		}
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		line := scanner.Text()
+
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !replCommand(interp, strings.TrimSpace(line)) {
+				return
+			}
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+		if !isBalanced(input.String()) {
+			continue
+		}
+
+		code := input.String()
+		input.Reset()
+		evalAndPrint(interp, code)
+	}
+}
+
+// replCommand executes a :command. It returns false if the REPL should exit.
+func replCommand(interp *interpreter.Interpreter, line string) bool {
+	command, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+
+	switch command {
+	case ":quit", ":q":
+		return false
+	case ":help":
+		fmt.Println(replHelp)
+	case ":scope":
+		fmt.Println(interp.Scope())
+	case ":reset":
+		interp.Reset()
+		loadPrelude(interp)
+	case ":load":
+		if argument == "" {
+			fmt.Println("Usage: :load <file>")
+			break
+		}
+		text, err := os.ReadFile(argument)
+		if err != nil {
+			fmt.Printf("Failed to read file '%s': %v\n", argument, err)
+			break
+		}
+		loadFile(interp, string(text), argument)
+	case ":suggest":
+		if argument == "" {
+			fmt.Println("Usage: :suggest <expr>")
+			break
+		}
+		runSource(interp, "$SUGGEST("+argument+")", replSource)
+	default:
+		fmt.Printf("Unknown command '%s'. Type :help for commands.\n", command)
+	}
+	return true
+}
+
+// loadPrelude runs the preludes of the toolchain in GISMO_TOOLCHAIN or ./toolchain, if there is one.
+func loadPrelude(interp *interpreter.Interpreter) {
+	tc, err := toolchain.Find("")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, path := range tc.Before {
+		before, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Failed to read toolchain file '%s': %v\n", path, err)
+			return
+		}
+		if _, ok := runSource(interp, string(before), path); !ok {
+			return
+		}
+	}
+}
+
+// runSource parses and runs code, printing errors instead of exiting.
+func runSource(interp *interpreter.Interpreter, code string, source string) (interpreter.Value, bool) {
+	ast, diagnostics := interp.Parse(code, source)
+	if len(diagnostics) > 0 {
+		interp.RenderSyntaxErrors(os.Stdout, diagnostics)
+		return nil, false
+	}
+	result, err := interp.Eval(ast)
+	if err != nil {
+		interp.RenderError(os.Stdout, err)
+		return nil, false
+	}
+	return result, true
+}
+
+// loadFile runs a file read by :load. The file counts as loaded, like one run by $LOAD,
+// so a $LOAD_ONCE of it afterwards does nothing.
+func loadFile(interp *interpreter.Interpreter, code string, path string) {
+	ast, diagnostics := interp.Parse(code, path)
+	if len(diagnostics) > 0 {
+		interp.RenderSyntaxErrors(os.Stdout, diagnostics)
+		return
+	}
+	if err := interp.RunSource(ast, path); err != nil {
+		interp.RenderError(os.Stdout, err)
+	}
+}
+
+// evalAndPrint evaluates the input and prints its value unless it is nil.
+func evalAndPrint(interp *interpreter.Interpreter, code string) {
+	replInputs++
+	result, ok := runSource(interp, code, fmt.Sprintf("<repl:%d>", replInputs))
+	if ok && result.GetTypeString() != "Nil" {
+		fmt.Println(result)
+	}
+}
+
+// isBalanced reports whether every opening parenthesis, bracket and brace in the code is closed.
+// The tokenizer is used so that brackets inside strings and comments are ignored.
+func isBalanced(code string) bool {
+	depth := 0
+	for _, token := range tokenizer.Tokenize(code, replSource) {
+		switch token.TokenType {
+		case tokentype.LParent, tokentype.LSquaredParent, tokentype.LCurlyParent:
+			depth++
+		case tokentype.RParent, tokentype.RSquaredParent, tokentype.RCurlyParent:
+			depth--
+		}
+	}
+	return depth <= 0
+}
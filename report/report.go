@@ -0,0 +1,155 @@
+// Package report converts parser and interpreter errors into structured diagnostics
+// and writes them as JSON or SARIF for tools such as CI annotators.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gismolang.org/compiler/interpreter"
+	"gismolang.org/compiler/parser"
+	"gismolang.org/compiler/tokenizer"
+)
+
+// Format selects how diagnostics are written.
+type Format string
+
+const (
+	FormatText  Format = "text"
+	FormatJSON  Format = "json"
+	FormatSARIF Format = "sarif"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatText, FormatJSON, FormatSARIF:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown diagnostics format '%s' (expected text, json or sarif)", name)
+}
+
+// Severity of a diagnostic
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Span is a range of source code. Lines and columns are 1-based, the end column is exclusive.
+type Span struct {
+	Source      string `json:"source"`
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+}
+
+// Related is a secondary location of a diagnostic, e.g. the definition of the macro being expanded.
+type Related struct {
+	Message string `json:"message"`
+	Span    Span   `json:"span"`
+}
+
+// Diagnostic is a single problem in machine-readable form.
+type Diagnostic struct {
+	Severity    string    `json:"severity"`
+	Code        string    `json:"code"`
+	Message     string    `json:"message"`
+	Span        *Span     `json:"span,omitempty"`
+	Related     []Related `json:"related,omitempty"`
+	Suggestions []string  `json:"suggestions,omitempty"`
+}
+
+// FromSyntaxErrors converts parser diagnostics.
+func FromSyntaxErrors(syntaxErrors []parser.Diagnostic) []Diagnostic {
+	diagnostics := make([]Diagnostic, len(syntaxErrors))
+	for i, syntaxError := range syntaxErrors {
+		diagnostics[i] = Diagnostic{
+			Severity: SeverityError,
+			Code:     interpreter.CodeSyntax,
+			Message:  syntaxError.Message(),
+			Span:     spanOf(syntaxError.Token, nil),
+		}
+	}
+	return diagnostics
+}
+
+// FromWarnings converts the warnings reported with $WARN.
+// If warnings are treated as errors (-Werror), their severity is error.
+func FromWarnings(warnings []interpreter.Warning, asErrors bool) []Diagnostic {
+	severity := SeverityWarning
+	if asErrors {
+		severity = SeverityError
+	}
+	diagnostics := make([]Diagnostic, len(warnings))
+	for i, warning := range warnings {
+		diagnostics[i] = Diagnostic{
+			Severity: severity,
+			Code:     warning.Code,
+			Message:  warning.Message,
+			Span:     spanOf(warning.Token, warning.End),
+		}
+	}
+	return diagnostics
+}
+
+// FromError converts an error returned by the interpreter.
+// Every macro expansion of the backtrace becomes a related span pointing at the definition.
+func FromError(err error) Diagnostic {
+	raised, ok := err.(*interpreter.Error)
+	if !ok {
+		return Diagnostic{Severity: SeverityError, Code: interpreter.CodeRuntime, Message: err.Error()}
+	}
+
+	diagnostic := Diagnostic{
+		Severity:    SeverityError,
+		Code:        raised.Code,
+		Message:     raised.Message,
+		Span:        spanOf(raised.Token, raised.End),
+		Suggestions: raised.Suggestions,
+	}
+	if diagnostic.Code == "" {
+		diagnostic.Code = interpreter.CodeRuntime
+	}
+	for _, frame := range raised.Backtrace {
+		span := spanOf(frame.DefinitionToken, nil)
+		if span == nil {
+			continue
+		}
+		diagnostic.Related = append(diagnostic.Related, Related{
+			Message: fmt.Sprintf("while expanding `%s`", frame.Signature),
+			Span:    *span,
+		})
+	}
+	return diagnostic
+}
+
+// spanOf returns the span from the start token to the end of the end token (nil for a single token).
+func spanOf(start *tokenizer.Token, end *tokenizer.Token) *Span {
+	if start == nil || start.Line < 1 {
+		return nil
+	}
+	if end == nil || end.Source != start.Source {
+		end = start
+	}
+	return &Span{
+		Source:      start.Source,
+		StartLine:   start.Line,
+		StartColumn: start.Column,
+		EndLine:     end.Line,
+		EndColumn:   end.Column + end.Width(),
+	}
+}
+
+// WriteJSON writes the diagnostics as a JSON object with a "diagnostics" array.
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}{diagnostics})
+}
@@ -0,0 +1,86 @@
+package report
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gismolang.org/compiler/interpreter"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	noMatch = Diagnostic{
+		Severity: SeverityError,
+		Code:     interpreter.CodeNoMatch,
+		Message:  "No match for macro 'int + string'",
+		Span:     &Span{Source: "main.gsm", StartLine: 3, StartColumn: 3, EndLine: 3, EndColumn: 4},
+		Related: []Related{{
+			Message: "while expanding `int + int`",
+			Span:    Span{Source: "lib/ops.gsm", StartLine: 1, StartColumn: 5, EndLine: 1, EndColumn: 6},
+		}},
+		Suggestions: []string{"int + int", "string + string"},
+	}
+	unused = Diagnostic{
+		Severity: SeverityWarning,
+		Code:     "unused",
+		Message:  "x is never used",
+		Span:     &Span{Source: "main.gsm", StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 2},
+	}
+	cancelled = Diagnostic{
+		Severity: SeverityError,
+		Code:     interpreter.CodeCancelled,
+		Message:  "Compilation cancelled: context canceled",
+	}
+)
+
+var goldenCases = []struct {
+	name        string
+	diagnostics []Diagnostic
+}{
+	{"error", []Diagnostic{noMatch}},
+	{"warning", []Diagnostic{unused}},
+	{"several", []Diagnostic{unused, noMatch, cancelled}},
+}
+
+// expectGolden compares the output with testdata/name, or rewrites the file with -update.
+func expectGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, output, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("%s: output differs from the golden file:\n%s", name, output)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	for _, c := range goldenCases {
+		var output bytes.Buffer
+		if err := WriteJSON(&output, c.diagnostics); err != nil {
+			t.Fatal(err)
+		}
+		expectGolden(t, c.name+".json", output.Bytes())
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	for _, c := range goldenCases {
+		var output bytes.Buffer
+		if err := WriteSARIF(&output, c.diagnostics); err != nil {
+			t.Fatal(err)
+		}
+		expectGolden(t, c.name+".sarif", output.Bytes())
+	}
+}
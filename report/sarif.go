@@ -0,0 +1,134 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// SARIF 2.1.0 (only the parts written by the compiler)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string           `json:"ruleId"`
+	Level            string           `json:"level"`
+	Message          sarifMessage     `json:"message"`
+	Locations        []sarifLocation  `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation  `json:"relatedLocations,omitempty"`
+	Properties       *sarifProperties `json:"properties,omitempty"`
+}
+
+type sarifProperties struct {
+	Suggestions []string `json:"suggestions"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// WriteSARIF writes the diagnostics as a SARIF 2.1.0 log with a single run.
+func WriteSARIF(w io.Writer, diagnostics []Diagnostic) error {
+	ruleIDs := map[string]bool{}
+	results := []sarifResult{}
+	for _, diagnostic := range diagnostics {
+		ruleIDs[diagnostic.Code] = true
+
+		result := sarifResult{
+			RuleID:  diagnostic.Code,
+			Level:   diagnostic.Severity,
+			Message: sarifMessage{Text: diagnostic.Message},
+		}
+		if diagnostic.Span != nil {
+			result.Locations = []sarifLocation{{PhysicalLocation: sarifPhysical(*diagnostic.Span)}}
+		}
+		for i, related := range diagnostic.Related {
+			id := i + 1
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               &id,
+				PhysicalLocation: sarifPhysical(related.Span),
+				Message:          &sarifMessage{Text: related.Message},
+			})
+		}
+		if len(diagnostic.Suggestions) > 0 {
+			result.Properties = &sarifProperties{Suggestions: diagnostic.Suggestions}
+		}
+		results = append(results, result)
+	}
+
+	rules := []sarifRule{}
+	for id := range ruleIDs {
+		rules = append(rules, sarifRule{ID: id})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "gismo", Rules: rules}},
+			Results: results,
+		}},
+	})
+}
+
+func sarifPhysical(span Span) sarifPhysicalLocation {
+	return sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(span.Source)},
+		Region: sarifRegion{
+			StartLine:   span.StartLine,
+			StartColumn: span.StartColumn,
+			EndLine:     span.EndLine,
+			EndColumn:   span.EndColumn,
+		},
+	}
+}
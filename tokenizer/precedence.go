@@ -0,0 +1,47 @@
+package tokenizer
+
+// PrecedenceTable holds the binding power and associativity of binary operators.
+// Tokens take their precedence from the table at tokenize time, so changes only
+// affect code that is tokenized afterwards. The version tells whether code parsed
+// earlier is still valid.
+type PrecedenceTable struct {
+	precedences map[string]int
+	rightAssoc  map[string]bool
+	version     int // Incremented by every Set that changes the table
+}
+
+// defaultPrecedenceTable is used by Tokenize and is never modified.
+var defaultPrecedenceTable = NewPrecedenceTable()
+
+// NewPrecedenceTable creates a table initialized with the default operator precedences.
+func NewPrecedenceTable() *PrecedenceTable {
+	table := &PrecedenceTable{
+		precedences: make(map[string]int),
+		rightAssoc:  make(map[string]bool),
+	}
+	for _, binaryPrecedence := range binaryPrecedences {
+		table.precedences[binaryPrecedence.operator] = binaryPrecedence.precedence
+	}
+	return table
+}
+
+// Set defines the precedence and associativity of a binary operator.
+func (table *PrecedenceTable) Set(operator string, precedence int, rightAssoc bool) {
+	if current, exists := table.precedences[operator]; exists && current == precedence && table.rightAssoc[operator] == rightAssoc {
+		return
+	}
+	table.precedences[operator] = precedence
+	table.rightAssoc[operator] = rightAssoc
+	table.version++
+}
+
+// Version returns a number that changes whenever the table does.
+func (table *PrecedenceTable) Version() int {
+	return table.version
+}
+
+// Lookup returns the precedence and associativity of a binary operator.
+func (table *PrecedenceTable) Lookup(operator string) (int, bool, bool) {
+	precedence, exists := table.precedences[operator]
+	return precedence, table.rightAssoc[operator], exists
+}
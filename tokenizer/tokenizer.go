@@ -4,20 +4,23 @@ import (
 	"fmt"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"gismolang.org/compiler/tokenizer/tokentype"
 )
 
 // Token represents a token parsed by the tokenizer.
 type Token struct {
-	TokenType tokentype.TokenType
-	Source    string
-	Pos       int
-	Line      int    // NEW: Line number (1-based)
-	Column    int    // NEW: Column number (1-based)
-	Value     string
-	Alias     string
-	BinPrec   int
+	TokenType  tokentype.TokenType
+	Source     string
+	Pos        int
+	Line       int // NEW: Line number (1-based)
+	Column     int // NEW: Column number (1-based)
+	Value      string
+	Alias      string
+	BinPrec    int
+	RightAssoc bool   // Binary operator groups to the right (a ** b ** c == a ** (b ** c))
+	Doc        string // Text of the /// doc comments directly preceding the token
 }
 
 // NoneToken is a sentinel token used to represent the absence of a token.
@@ -55,16 +58,8 @@ var oneCharacterTokens = map[rune]tokentype.TokenType{
 	']': tokentype.RSquaredParent,
 }
 
-// Operator precedence maps for binary and unary operators.
-var binaryPrecedenceMap = map[string]int{}
-
-// Initialize precedence maps
-func init() {
-	for _, binaryPrecedence := range binaryPrecedences {
-		binaryPrecedenceMap[binaryPrecedence.operator] = binaryPrecedence.precedence
-	}
-}
-
+// Default binary operator precedences. All of them are left-associative.
+// Dialects can change or extend them at runtime through a PrecedenceTable.
 var binaryPrecedences = []struct {
 	operator   string
 	precedence int
@@ -76,24 +71,49 @@ var binaryPrecedences = []struct {
 	{"&", 8}, {"|", 7},
 }
 
+// guardKeyword separates the pattern of a definition from its guard: `int / int where g ::= ...`.
+// It binds below the operators of the pattern and above ::=, but only in the head of a definition;
+// anywhere else it is an ordinary identifier.
+const (
+	guardKeyword    = "where"
+	guardPrecedence = 2
+)
+
 const FunctionCallPrecedence = 16
 const CurlyCallPrecedence = 14
 const identifierPrecedence = 4
 const UnaryPrecedence = 15 
 
-// Tokenize converts the input code into a list of tokens.
+// Tokenize converts the input code into a list of tokens using the default operator precedences.
 func Tokenize(code string, source string) []*Token {
+	return TokenizeWithPrecedences(code, source, defaultPrecedenceTable)
+}
+
+// TokenizeWithPrecedences converts the input code into a list of tokens,
+// taking binary operator precedences and associativities from the given table.
+func TokenizeWithPrecedences(code string, source string, precedences *PrecedenceTable) []*Token {
 	var tokens []*Token
+	var docLines []string
 	r := CreateStringReader(code)
 
 	for r.PeekNext(0) != '\000' { // While there are more characters
 		current := r.Next()
+		if isDocComment(current, &r) {
+			docLines = append(docLines, readDocComment(&r))
+			continue
+		}
 		if token := nextToken(current, &r, source); token != nil {
+			// Doc comments are trivia of the next real token, so skip over the line breaks in between
+			if len(docLines) > 0 && token.TokenType != tokentype.Newline {
+				token.Doc = strings.Join(docLines, "\n")
+				docLines = nil
+			}
 			tokens = append(tokens, token)
 		}
 	}
 
-	mapBinaryPrecedence(tokens)
+	mapBinaryPrecedence(tokens, precedences)
+	markGuardKeywords(tokens)
 
 	return tokens
 }
@@ -109,6 +129,11 @@ func nextToken(current rune, r *StringReader, source string) *Token {
 	case current == '/' && r.PeekNext(0) == '/':
 		skipLineComment(r)
 		return nil
+	case current == '/' && r.PeekNext(0) == '*':
+		if !skipBlockComment(r) {
+			return createToken(tokentype.Illegal, source, startPos, startLine, startCol, "/*")
+		}
+		return nil
 	case current == '\\' && (r.PeekNext(0) == '\n' || (r.PeekNext(0) == '\r' && r.PeekNext(1) == '\n')):
 		skipLineContinuation(r)
 		return nil
@@ -164,6 +189,16 @@ func createIdentifierToken(current rune, r *StringReader, source string, pos, li
 	value := readCharacters(r, current, func(r rune) bool {
 		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_$", r)
 	})
+	// $... is the placeholder for the rest arguments of a variadic macro
+	if value == "$" && r.PeekNext(0) == '.' && r.PeekNext(1) == '.' && r.PeekNext(2) == '.' {
+		value += string([]rune{r.Next(), r.Next(), r.Next()})
+	}
+	// A parameterized type like Pointer<int> or Map<K,Vector<V>> is a single identifier
+	if length := typeArgumentsLength(r, 0); length > 0 && !strings.HasPrefix(value, "$") {
+		for i := 0; i < length; i++ {
+			value += string(r.Next())
+		}
+	}
 	return &Token{
 		TokenType: tokentype.Identifier,
 		Source:    source,
@@ -176,6 +211,52 @@ func createIdentifierToken(current rune, r *StringReader, source string, pos, li
 	}
 }
 
+// typeArgumentsLength returns the number of runes of the type argument list <a,b<c>> starting at
+// offset, or 0 if there is none. The list may not contain whitespace, so a<b is still a comparison.
+// Neither may it be directly followed by an operand or by =, so g(a<b,c>d) and a<b,c>=d compare too.
+func typeArgumentsLength(r *StringReader, offset int) int {
+	length := typeArgumentListLength(r, offset)
+	if length > 0 && followsComparison(r.PeekNext(offset+length)) {
+		return 0
+	}
+	return length
+}
+
+// followsComparison reports whether the rune after a > can only continue a comparison.
+func followsComparison(next rune) bool {
+	return isIdentifierRune(next) || strings.ContainsRune("=(\"$", next)
+}
+
+// typeArgumentListLength returns the number of runes of the balanced type argument list starting at offset.
+func typeArgumentListLength(r *StringReader, offset int) int {
+	if r.PeekNext(offset) != '<' {
+		return 0
+	}
+	i := offset + 1
+	for {
+		start := i
+		for isIdentifierRune(r.PeekNext(i)) {
+			i++
+		}
+		if i == start {
+			return 0
+		}
+		i += typeArgumentListLength(r, i)
+		switch r.PeekNext(i) {
+		case ',':
+			i++
+		case '>':
+			return i + 1 - offset
+		default:
+			return 0
+		}
+	}
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
 // Creates a number token (Integer, Float, Hex, Bin, Octal).
 func createNumberToken(current rune, r *StringReader, source string, pos, line, col int) *Token {
 	var builder strings.Builder
@@ -259,9 +340,13 @@ func isHexDigit(r rune) bool {
 
 // Creates an operator token.
 func createOperatorToken(current rune, r *StringReader, source string, pos, line, col int) *Token {
-	value := readCharacters(r, current, func(r rune) bool {
-		return strings.ContainsRune("+-*/=~#:?!%&|,.^<>@", r)
-	})
+	var builder strings.Builder
+	builder.WriteRune(current)
+	// Stop in front of "//" and "/*" so a comment directly after an operator is not swallowed
+	for strings.ContainsRune("+-*/=~#:?!%&|,.^<>@", r.PeekNext(0)) && !isCommentStart(r, 0) {
+		builder.WriteRune(r.Next())
+	}
+	value := builder.String()
 	return &Token{
 		TokenType: tokentype.Operator,
 		Source:    source,
@@ -319,6 +404,53 @@ func skipLineComment(r *StringReader) {
 	}
 }
 
+// Reports whether a comment starts at the given offset of the reader.
+func isCommentStart(r *StringReader, index int) bool {
+	return r.PeekNext(index) == '/' && (r.PeekNext(index+1) == '/' || r.PeekNext(index+1) == '*')
+}
+
+// Reports whether the consumed rune starts a /// doc comment.
+// Four or more slashes are treated as an ordinary line comment.
+func isDocComment(current rune, r *StringReader) bool {
+	return current == '/' && r.PeekNext(0) == '/' && r.PeekNext(1) == '/' && r.PeekNext(2) != '/'
+}
+
+// Reads a doc comment and returns its text without the leading slashes.
+func readDocComment(r *StringReader) string {
+	r.Next() // consume second '/'
+	r.Next() // consume third '/'
+	if r.PeekNext(0) == ' ' {
+		r.Next()
+	}
+	var builder strings.Builder
+	for r.PeekNext(0) != '\n' && r.PeekNext(0) != '\000' {
+		builder.WriteRune(r.Next())
+	}
+	return strings.TrimRight(builder.String(), "\r")
+}
+
+// Skips a block comment. Block comments nest, so every /* needs its own */.
+// An unterminated block comment runs until the end of the input; skipBlockComment then reports false.
+func skipBlockComment(r *StringReader) bool {
+	r.Next() // consume '*'
+	depth := 1
+	for depth > 0 && r.PeekNext(0) != '\000' {
+		switch {
+		case r.PeekNext(0) == '/' && r.PeekNext(1) == '*':
+			r.Next()
+			r.Next()
+			depth++
+		case r.PeekNext(0) == '*' && r.PeekNext(1) == '/':
+			r.Next()
+			r.Next()
+			depth--
+		default:
+			r.Next()
+		}
+	}
+	return depth == 0
+}
+
 // Skips a line continuation.
 func skipLineContinuation(r *StringReader) {
 	if r.PeekNext(0) == '\n' {
@@ -330,14 +462,51 @@ func skipLineContinuation(r *StringReader) {
 }
 
 // Maps binary operator precedences to tokens.
-func mapBinaryPrecedence(tokens []*Token) {
+func mapBinaryPrecedence(tokens []*Token, precedences *PrecedenceTable) {
 	for _, token := range tokens {
-		if token.TokenType == tokentype.Operator {
-			if precedence, exists := binaryPrecedenceMap[token.Value]; exists {
+		if token.TokenType == tokentype.Operator || token.TokenType == tokentype.Identifier {
+			if precedence, rightAssoc, exists := precedences.Lookup(token.Value); exists {
 				token.BinPrec = precedence
+				token.RightAssoc = rightAssoc
+			}
+		}
+	}
+}
+
+// markGuardKeywords gives the guard precedence to every `where` followed by ::= in the same statement
+// and at the same bracket depth.
+func markGuardKeywords(tokens []*Token) {
+	for i, token := range tokens {
+		if token.TokenType == tokentype.Identifier && token.Value == guardKeyword && startsDefinitionBody(tokens[i+1:]) {
+			token.BinPrec = guardPrecedence
+			token.RightAssoc = false
+		}
+	}
+}
+
+// startsDefinitionBody reports whether a ::= follows before the statement or the enclosing bracket ends.
+func startsDefinitionBody(tokens []*Token) bool {
+	depth := 0
+	for _, token := range tokens {
+		switch token.TokenType {
+		case tokentype.LParent, tokentype.LSquaredParent, tokentype.LCurlyParent:
+			depth++
+		case tokentype.RParent, tokentype.RSquaredParent, tokentype.RCurlyParent:
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case tokentype.Newline:
+			if depth == 0 {
+				return false
+			}
+		case tokentype.Operator:
+			if depth == 0 && token.Value == "::=" {
+				return true
 			}
 		}
 	}
+	return false
 }
 
 func (token Token) String() string {
@@ -345,4 +514,15 @@ func (token Token) String() string {
 		return fmt.Sprintf("%s(%d) ", token.TokenType, token.BinPrec)
 	}
 	return fmt.Sprintf("%s ", token.TokenType)
-}
\ No newline at end of file
+}
+// Width returns the number of columns the token covers in the source, at least 1.
+func (token Token) Width() int {
+	width := utf8.RuneCountInString(token.Value)
+	if token.TokenType == tokentype.String {
+		width += 2 // Quotes
+	}
+	if width == 0 {
+		width = 1
+	}
+	return width
+}
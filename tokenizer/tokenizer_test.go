@@ -0,0 +1,37 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+// values returns the values of the tokens, separated by spaces.
+func values(code string) string {
+	var result []string
+	for _, token := range Tokenize(code, "test.gsm") {
+		result = append(result, token.Value)
+	}
+	return strings.Join(result, " ")
+}
+
+func expectTokens(t *testing.T, code string, expected string) {
+	t.Helper()
+	if got := values(code); got != expected {
+		t.Errorf("%s: expected tokens %q, got %q", code, expected, got)
+	}
+}
+
+func TestParameterizedTypes(t *testing.T) {
+	expectTokens(t, "$TYPEDEF(addr, Pointer<int>)", "$TYPEDEF ( addr , Pointer<int> )")
+	expectTokens(t, "Map<K,Vector<V>> + int", "Map<K,Vector<V>> + int")
+	expectTokens(t, "Pointer<T>", "Pointer<T>")
+}
+
+func TestComparisonsAreNotTypeArguments(t *testing.T) {
+	expectTokens(t, "a<b", "a < b")
+	expectTokens(t, "g(a<b,c>d)", "g ( a < b , c > d )")
+	expectTokens(t, "g(a<b,c>1)", "g ( a < b , c > 1 )")
+	expectTokens(t, "a<b,c>=d", "a < b , c >= d")
+	expectTokens(t, "a<b,c>(d)", "a < b , c > ( d )")
+	expectTokens(t, "a < b, c > d", "a < b , c > d")
+}
@@ -19,6 +19,7 @@ const (
 	Semicolon                        // Semicolon ';'
 	Newline                          // Newline character
 	Module                           // Module keyword or token
+	Illegal                          // Malformed input, such as an unterminated block comment
 )
 
 // String returns a string representation of the TokenType.
@@ -52,6 +53,8 @@ func (tokenType TokenType) String() string {
 		return "<Newline>"
 	case Module:
 		return "<Module>"
+	case Illegal:
+		return "<Illegal>"
 	default:
 		return "<Unknown TokenType>" // Fallback for unrecognized token types
 	}
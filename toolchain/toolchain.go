@@ -0,0 +1,121 @@
+// Package toolchain locates a toolchain directory and the prelude and postlude files it declares.
+//
+// A toolchain may list its files in a manifest named toolchain.cfg:
+//
+//	# Run in this order before the program
+//	before prelude.gsm
+//	before types.gsm
+//	# Run after the program
+//	after after.gsm
+//
+// Paths are relative to the toolchain directory. Without a manifest, before.gsm and after.gsm
+// are used if they exist.
+package toolchain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDir is the toolchain used if none is requested, relative to the working directory.
+const DefaultDir = "toolchain"
+
+// EnvVar names the environment variable selecting the toolchain directory.
+const EnvVar = "GISMO_TOOLCHAIN"
+
+// ManifestName is the file in a toolchain directory listing its preludes and postludes.
+const ManifestName = "toolchain.cfg"
+
+// Toolchain is a directory of Gismo files run around the program.
+type Toolchain struct {
+	Dir    string
+	Before []string // Preludes, in the order they run
+	After  []string // Postludes, in the order they run
+}
+
+// Find returns the requested toolchain: the directory passed with --toolchain, else the one in
+// GISMO_TOOLCHAIN, else ./toolchain. A requested toolchain that does not exist is an error;
+// if the default one does not exist, an empty toolchain is returned.
+func Find(dir string) (*Toolchain, error) {
+	explicit := true
+	if dir == "" {
+		dir = os.Getenv(EnvVar)
+	}
+	if dir == "" {
+		dir = DefaultDir
+		explicit = false
+	}
+
+	toolchain, err := Load(dir)
+	if err != nil && !explicit && errors.Is(err, fs.ErrNotExist) {
+		return &Toolchain{}, nil
+	}
+	return toolchain, err
+}
+
+// Load reads the toolchain in dir. Every file it declares must exist.
+func Load(dir string) (*Toolchain, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("toolchain '%s': %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("toolchain '%s' is not a directory", dir)
+	}
+
+	toolchain := &Toolchain{Dir: dir}
+	manifestPath := filepath.Join(dir, ManifestName)
+	file, err := os.Open(manifestPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// No manifest: the conventional file names, each optional
+		if path := filepath.Join(dir, "before.gsm"); exists(path) {
+			toolchain.Before = append(toolchain.Before, path)
+		}
+		if path := filepath.Join(dir, "after.gsm"); exists(path) {
+			toolchain.After = append(toolchain.After, path)
+		}
+		return toolchain, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind, name, _ := strings.Cut(line, " ")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("%s:%d: missing file name", manifestPath, lineNumber)
+		}
+		path := filepath.Join(dir, name)
+		if !exists(path) {
+			return nil, fmt.Errorf("%s:%d: file '%s' does not exist", manifestPath, lineNumber, path)
+		}
+
+		switch kind {
+		case "before":
+			toolchain.Before = append(toolchain.Before, path)
+		case "after":
+			toolchain.After = append(toolchain.After, path)
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown entry '%s' (expected before or after)", manifestPath, lineNumber, kind)
+		}
+	}
+	return toolchain, scanner.Err()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}